@@ -0,0 +1,66 @@
+// Package accesslog writes a structured log line for every HTTP request.
+package accesslog
+
+import (
+	"net/http"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	"bitbucket.org/iwlab-standuply/slackteams-api/router"
+	log "github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	// Skip are route patterns not logged, like probes scraped every few seconds.
+	Skip []string
+}
+
+type Logger struct {
+	skip map[string]bool
+}
+
+func New(conf Config) *Logger {
+	l := &Logger{skip: map[string]bool{}}
+	for _, route := range conf.Skip {
+		l.skip[route] = true
+	}
+
+	return l
+}
+
+// Middleware logs requests once they are served, it must follow the middleware loading the principal
+// and wrap routes of a router, as it tells routes by their patterns. The request ID is added by the
+// formatters of the logger package.
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := response.NewRecorder(w)
+
+		// Deferred to log requests aborted by a panic too.
+		defer l.log(r, rec, time.Now())
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func (l *Logger) log(r *http.Request, rec *response.Recorder, start time.Time) {
+	route := router.Pattern(r)
+	if l.skip[route] {
+		return
+	}
+
+	fields := log.Fields{
+		"method":    r.Method,
+		"route":     route,
+		"path":      r.URL.Path,
+		"status":    rec.Status(),
+		"bytes":     rec.Bytes(),
+		"latencyMs": float64(time.Since(start).Microseconds()) / 1000,
+		"remote":    r.RemoteAddr,
+	}
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		fields["principal"] = p.Name
+	}
+
+	log.WithContext(r.Context()).WithFields(fields).Info("HTTP request")
+}
@@ -0,0 +1,140 @@
+// Package activity keeps the most recent HTTP and RPC requests in memory, for support engineers to look at.
+package activity
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/amqp"
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	"bitbucket.org/iwlab-standuply/slackteams-api/router"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+)
+
+const (
+	KindHTTP = "http"
+	KindRPC  = "rpc"
+)
+
+// Entry is a served request. Name is the route pattern of HTTP requests and the routing key of RPC ones.
+type Entry struct {
+	At        time.Time
+	Kind      string
+	Method    string
+	Name      string
+	Principal string
+	Status    string
+	Failed    bool
+	Duration  time.Duration
+	RequestID string
+}
+
+// Log is a ring of the last entries, older ones are overwritten.
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+func NewLog(size int) *Log {
+	return &Log{
+		entries: make([]Entry, size),
+	}
+}
+
+func (l *Log) Add(e Entry) {
+	if len(l.entries) == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the entries, newest first.
+func (l *Log) Recent() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+
+	res := make([]Entry, 0, n)
+	for i := 1; i <= n; i++ {
+		res = append(res, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+
+	return res
+}
+
+// HTTP records requests of authenticated callers, so probes and icon loads do not push out the rest.
+// It must follow the middleware loading the principal.
+func (l *Log) HTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := response.NewRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		name := router.Pattern(r)
+		if name == "" {
+			name = r.URL.Path
+		}
+
+		l.Add(Entry{
+			At:        start,
+			Kind:      KindHTTP,
+			Method:    r.Method,
+			Name:      name,
+			Principal: p.Name,
+			Status:    strconv.Itoa(rec.Status()),
+			Failed:    rec.Status() >= http.StatusBadRequest,
+			Duration:  time.Since(start),
+			RequestID: response.RequestID(r.Context()),
+		})
+	})
+}
+
+// RPC records messages of an RPC method, it is a middleware of rpc.Server.
+func (l *Log) RPC(routingKey string, next rpc.MessageHandler) rpc.MessageHandler {
+	return func(m amqp.ConsumerMessage) error {
+		start := time.Now()
+
+		err := next(m)
+
+		e := Entry{
+			At:        start,
+			Kind:      KindRPC,
+			Name:      routingKey,
+			Status:    "ok",
+			Duration:  time.Since(start),
+			RequestID: m.GetCorrelationId(),
+		}
+		if err != nil {
+			e.Status = err.Error()
+			e.Failed = true
+		}
+
+		l.Add(e)
+
+		return err
+	}
+}
@@ -4,17 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"sync"
 	"time"
 
 	"bitbucket.org/iwlab-standuply/slackteams-api/shared"
 	"github.com/marcuzy/rabbus"
 	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
 )
 
 var (
 	ErrNoRPCResponse = errors.New("no rpc response")
+	ErrNotConnected  = errors.New("not connected")
+	ErrBreakerOpen   = errors.New("circuit breaker open, publishing fails")
 )
 
+// pingRoutingKey is bound to no queue, the broker drops what is published with it.
+const pingRoutingKey = "slackTeams.api.ping"
+
 // NOTE: instance of rabbus.Rabbus uses single channel for all operations so can Produce only one message at once (blocking until prev message is sent)
 // maybe we should create an AMQP instance (lib's internal class) and pass it to every Robbus instance to share connection
 type (
@@ -31,6 +38,8 @@ type (
 		PublishRPCResponse(ctx context.Context, params RPCResponseParams) error
 
 		Connect(ctx context.Context) error
+		// Err tells why the client cannot talk to RabbitMQ now, it is nil while the client is connected.
+		Err() error
 		Close()
 	}
 
@@ -61,39 +70,56 @@ type (
 	}
 
 	amqpClient struct {
-		url                string
 		rpcResponsesQ      string
 		rpcResponseTimeout time.Duration
 
 		r            *rabbus.Rabbus
 		rpcResponses map[string]chan ConsumerMessage
+
+		mu          sync.Mutex
+		connErr     error
+		breakerOpen bool
+		closing     bool
+		done        chan struct{}
+		watching    sync.WaitGroup
 	}
 )
 
 func NewClient(url string) Client {
+	c := &amqpClient{
+		rpcResponses:       make(map[string]chan ConsumerMessage),
+		rpcResponsesQ:      "slackTeams.rpcResponses",
+		rpcResponseTimeout: time.Minute * 1,
+		connErr:            ErrNotConnected,
+		done:               make(chan struct{}),
+	}
+
 	r, err := rabbus.New(
 		url,
 		rabbus.Durable(true),
 		rabbus.Attempts(5),
 		rabbus.Sleep(time.Second*2),
 		rabbus.Threshold(3),
-		// rabbus.OnStateChange(cbStateChangeFunc),
+		rabbus.OnStateChange(c.onBreakerStateChange),
 	)
 
 	if err != nil {
 		panic(err)
 	}
 
-	return &amqpClient{
-		url:                url,
-		rpcResponses:       make(map[string]chan ConsumerMessage),
-		rpcResponsesQ:      "slackTeams.rpcResponses",
-		rpcResponseTimeout: time.Minute * 1,
-		r:                  r,
-	}
+	c.r = r
+
+	return c
 }
 
 func (c *amqpClient) Connect(ctx context.Context) error {
+	// rabbus connected in NewClient and does not swap the connection before it runs.
+	closed := c.r.NotifyClose(make(chan *amqp.Error, 1))
+	c.setConnErr(nil)
+
+	c.watching.Add(1)
+	go c.watchConnection(closed)
+
 	go func() {
 		err := c.r.Run(context.Background())
 
@@ -111,7 +137,110 @@ func (c *amqpClient) Connect(ctx context.Context) error {
 	return nil
 }
 
+func (c *amqpClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connErr != nil {
+		return c.connErr
+	}
+
+	if c.breakerOpen {
+		return ErrBreakerOpen
+	}
+
+	return nil
+}
+
+func (c *amqpClient) setConnErr(err error) {
+	c.mu.Lock()
+	c.connErr = err
+	c.mu.Unlock()
+}
+
+func (c *amqpClient) onBreakerStateChange(name, from, to string) {
+	log.WithField("from", from).WithField("to", to).Warn("AMQP circuit breaker changed state")
+
+	c.mu.Lock()
+	c.breakerOpen = to == "open"
+	c.mu.Unlock()
+}
+
+// watchConnection keeps the state of the connection rabbus holds until the client is closed. rabbus swaps
+// its connection after a loss without telling, so a lost connection counts as restored once a ping went
+// through rabbus: it takes the ping only after it has reconnected.
+func (c *amqpClient) watchConnection(closed chan *amqp.Error) {
+	defer c.watching.Done()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case amqpErr := <-closed:
+			// A connection that closed before its NotifyClose was registered answers nil.
+			var err error = ErrNotConnected
+			if amqpErr != nil {
+				err = amqpErr
+			}
+
+			log.WithError(err).Error("AMQP connection lost")
+			c.setConnErr(err)
+		}
+
+		if !c.ping() {
+			return
+		}
+
+		// Taking the ping rabbus has swapped its connection for the new one, that one is watched now.
+		closed = c.r.NotifyClose(make(chan *amqp.Error, 1))
+		c.setConnErr(nil)
+		log.Info("AMQP connection restored")
+	}
+}
+
+// ping publishes a message no queue is bound to every second until it is published,
+// it gives up when the client is closed.
+func (c *amqpClient) ping() bool {
+	msg := newRobbusMessage(&message{
+		Exchange: "slackTeams.api.response",
+		Key:      pingRoutingKey,
+		Kind:     "direct",
+	})
+
+	for {
+		select {
+		case <-c.done:
+			return false
+		case c.r.EmitAsync() <- msg:
+		}
+
+		select {
+		case err := <-c.r.EmitErr():
+			c.setConnErr(err)
+		case <-c.r.EmitOk():
+			return true
+		}
+
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+}
+
 func (c *amqpClient) Close() {
+	c.mu.Lock()
+	if !c.closing {
+		c.closing = true
+		close(c.done)
+	}
+	c.mu.Unlock()
+
+	// rabbus closes its channels, the watcher must not be publishing a ping then.
+	c.watching.Wait()
+	c.setConnErr(ErrNotConnected)
+
 	if c.r != nil {
 		c.r.Close()
 	}
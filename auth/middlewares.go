@@ -7,26 +7,41 @@ import (
 
 // LoadContextMiddleware puts information about current user into request context.
 // This middleware is required and should be connected to mux of a route.
+// Requests without a token in the Authorization header are authenticated by their client certificate,
+// when the TLS server verified one.
 func LoadContextMiddleware(as Service) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenStr := ""
 			if len(r.Header["Authorization"]) == 1 {
-				tokenStr := r.Header["Authorization"][0]
+				tokenStr = r.Header["Authorization"][0]
+			}
+
+			var (
+				principal *Principal
+				err       error
+			)
 
-				user, err := as.FindUserByToken(r.Context(), tokenStr)
+			switch {
+			case tokenStr != "":
+				principal, err = as.FindPrincipalByToken(r.Context(), tokenStr)
+			case r.TLS != nil && len(r.TLS.VerifiedChains) > 0:
+				principal, err = as.FindPrincipalByCertificate(r.Context(), r.TLS.VerifiedChains[0][0])
+			default:
+				err = ErrTokenNotFound
+			}
 
-				if err == nil {
-					r = r.WithContext(
-						context.WithValue(
-							r.Context(),
-							CtxKeyAuthUser,
-							user,
-						),
-					)
-				}
+			if err == nil {
+				r = r.WithContext(WithPrincipal(r.Context(), principal))
 			}
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// WithPrincipal returns a copy of ctx that carries the principal and its name.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	ctx = context.WithValue(ctx, CtxKeyPrincipal, principal)
+	return context.WithValue(ctx, CtxKeyAuthUser, principal.Name)
+}
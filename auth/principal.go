@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+)
+
+type Role string
+
+const (
+	RoleBot    Role = "standuply-bot"
+	RoleMeteor Role = "meteor"
+	RoleAdmin  Role = "admin"
+	// RoleSupport is for support engineers, who look at teams in the dashboard but never see tokens.
+	RoleSupport Role = "support"
+	// RoleReader only reads teams, it is the role of RPC callers without a token by default.
+	RoleReader Role = "reader"
+)
+
+type Permission string
+
+const (
+	PermReadTeams           Permission = "read:teams"
+	PermReadTokens          Permission = "read:tokens"
+	PermWriteAuthorizations Permission = "write:authorizations"
+	PermViewDashboard       Permission = "view:dashboard"
+)
+
+// RolePermissions is what every role is allowed to do. Unknown roles are allowed nothing.
+var RolePermissions = map[Role][]Permission{
+	RoleBot:     {PermReadTeams, PermReadTokens},
+	RoleMeteor:  {PermReadTeams, PermWriteAuthorizations},
+	RoleAdmin:   {PermReadTeams, PermReadTokens, PermWriteAuthorizations, PermViewDashboard},
+	RoleSupport: {PermReadTeams, PermViewDashboard},
+	RoleReader:  {PermReadTeams},
+}
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Name  string
+	Roles []Role
+}
+
+func (p *Principal) HasRole(role Role) bool {
+	if p == nil {
+		return false
+	}
+
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Can reports whether any role of the principal grants perm.
+func (p *Principal) Can(perm Permission) bool {
+	if p == nil {
+		return false
+	}
+
+	for _, r := range p.Roles {
+		for _, granted := range RolePermissions[r] {
+			if granted == perm {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// PrincipalFromContext returns the principal LoadContextMiddleware found for the request.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(CtxKeyPrincipal).(*Principal)
+	return p, ok && p != nil
+}
+
+// Require is the access policy of a route: the caller needs all of perms.
+// It answers 401 to anonymous callers and 403 to callers without a permission.
+func Require(perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				response.Error(w, r, errors.E(errors.KindUnauthorized, "authorization required"))
+				return
+			}
+
+			for _, perm := range perms {
+				if !p.Can(perm) {
+					response.Error(w, r, errors.E(errors.KindForbidden, "forbidden - "+string(perm)+" required"))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
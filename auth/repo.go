@@ -1,7 +1,15 @@
 package auth
 
-import "context"
+import (
+	"context"
+	"crypto/x509"
+)
 
 type Repository interface {
-	FindUserByToken(ctx context.Context, token string) (string, error)
+	FindPrincipalByToken(ctx context.Context, token string) (*Principal, error)
+}
+
+// CertificateRepository finds principals of client certificates the TLS server verified.
+type CertificateRepository interface {
+	FindPrincipalByCertificate(ctx context.Context, cert *x509.Certificate) (*Principal, error)
 }
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"crypto/x509"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -21,31 +22,46 @@ var (
 type CtxKey string
 
 const (
-	CtxKeyAuthUser CtxKey = "authUser"
+	// CtxKeyAuthUser holds the name of the principal.
+	CtxKeyAuthUser  CtxKey = "authUser"
+	CtxKeyPrincipal CtxKey = "principal"
 )
 
 type Service interface {
-	FindUserByToken(ctx context.Context, token string) (string, error)
+	FindPrincipalByToken(ctx context.Context, token string) (*Principal, error)
+	FindPrincipalByCertificate(ctx context.Context, cert *x509.Certificate) (*Principal, error)
 }
 
 type service struct {
-	repo  Repository
-	cache *cache.Cache
+	repo         Repository
+	certificates CertificateRepository
+	cache        *cache.Cache
 }
 
 type Config struct {
 	UserRepository Repository
+	// CertificateRepository maps client certificates to principals, nil accepts none.
+	CertificateRepository CertificateRepository
 }
 
 func NewAuthService(conf Config) (Service, error) {
 	as := &service{
-		repo:  conf.UserRepository,
-		cache: cache.New(5*time.Minute, 10*time.Minute),
+		repo:         conf.UserRepository,
+		certificates: conf.CertificateRepository,
+		cache:        cache.New(5*time.Minute, 10*time.Minute),
 	}
 
 	return as, nil
 }
 
-func (a *service) FindUserByToken(ctx context.Context, token string) (string, error) {
-	return a.repo.FindUserByToken(ctx, token)
+func (a *service) FindPrincipalByToken(ctx context.Context, token string) (*Principal, error) {
+	return a.repo.FindPrincipalByToken(ctx, token)
+}
+
+func (a *service) FindPrincipalByCertificate(ctx context.Context, cert *x509.Certificate) (*Principal, error) {
+	if a.certificates == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return a.certificates.FindPrincipalByCertificate(ctx, cert)
 }
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+)
+
+type authorizationsRepository struct {
+	repo  handler.AuthorizationsRepository
+	cache *Cache
+}
+
+// NewAuthorizationsRepository caches authorizations looked up by team. Cache keys are Slack team IDs.
+// GetAllAuthorizations is not cached as the bot calls it only on start. Cached authorizations are loaded
+// whole, whatever fields callers select.
+func NewAuthorizationsRepository(repo handler.AuthorizationsRepository, cache *Cache) handler.AuthorizationsRepository {
+	return &authorizationsRepository{
+		repo:  repo,
+		cache: cache,
+	}
+}
+
+func (r *authorizationsRepository) GetAllAuthorizations(ctx context.Context) ([]*handler.SlackBotAuthorization, error) {
+	return r.repo.GetAllAuthorizations(ctx)
+}
+
+func (r *authorizationsRepository) GetAuthorization(ctx context.Context, teamId string) (*handler.SlackBotAuthorization, error) {
+	v, err := r.cache.Get(ctx, teamId, func(ctx context.Context) (interface{}, error) {
+		return r.repo.GetAuthorization(handler.WithAuthorizationFields(ctx, nil), teamId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*handler.SlackBotAuthorization), nil
+}
+
+// GetAuthorizations serves cached teams and looks the rest up with a single call of the repository.
+func (r *authorizationsRepository) GetAuthorizations(ctx context.Context, teamIDs []string) (*handler.AuthorizationsBatch, error) {
+	found, err := r.cache.GetMany(ctx, teamIDs, handler.ErrNotFound, func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		batch, err := r.repo.GetAuthorizations(handler.WithAuthorizationFields(ctx, nil), keys)
+		if err != nil {
+			return nil, err
+		}
+
+		res := make(map[string]interface{}, len(batch.Authorizations))
+		for _, a := range batch.Authorizations {
+			res[a.TeamId] = a
+		}
+
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &handler.AuthorizationsBatch{}
+	seen := make(map[string]bool, len(teamIDs))
+
+	for _, teamID := range teamIDs {
+		if seen[teamID] {
+			continue
+		}
+		seen[teamID] = true
+
+		if v, ok := found[teamID]; ok {
+			res.Authorizations = append(res.Authorizations, v.(*handler.SlackBotAuthorization))
+		} else {
+			res.Missing = append(res.Missing, teamID)
+		}
+	}
+
+	return res, nil
+}
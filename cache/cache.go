@@ -0,0 +1,208 @@
+// Package cache provides read-through caching decorators for the repositories.
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"golang.org/x/sync/singleflight"
+)
+
+type Config struct {
+	// TTL is how long a found value is kept.
+	TTL time.Duration
+	// NegativeTTL is how long a not found result is kept. Zero disables negative caching.
+	NegativeTTL time.Duration
+	// LoadTimeout bounds a load shared by concurrent callers, DefaultLoadTimeout when zero.
+	LoadTimeout time.Duration
+}
+
+// DefaultLoadTimeout is the LoadTimeout of configs without one.
+const DefaultLoadTimeout = 10 * time.Second
+
+type Stats struct {
+	Name         string `json:"name"`
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negativeHits"`
+	Misses       uint64 `json:"misses"`
+	Items        int    `json:"items"`
+}
+
+// notFound is stored in place of a value the repository did not find.
+type notFound struct {
+	err error
+}
+
+// Cache is a TTL cache that loads missing keys once, no matter how many callers miss them concurrently.
+type Cache struct {
+	// Counters go first to keep them 64-bit aligned for atomic access.
+	hits         uint64
+	negativeHits uint64
+	misses       uint64
+	// generation changes on every invalidation so loads that started before it are not stored.
+	generation uint64
+
+	name       string
+	conf       Config
+	isNotFound func(error) bool
+	store      *gocache.Cache
+	group      singleflight.Group
+}
+
+// New creates a cache. isNotFound tells which load errors are cached as negative results.
+func New(name string, conf Config, isNotFound func(error) bool) *Cache {
+	if conf.LoadTimeout <= 0 {
+		conf.LoadTimeout = DefaultLoadTimeout
+	}
+
+	return &Cache{
+		name:       name,
+		conf:       conf,
+		isNotFound: isNotFound,
+		store:      gocache.New(conf.TTL, 2*conf.TTL),
+	}
+}
+
+// Get returns the value cached for key or calls load to get it.
+// Errors other than not found are returned to the caller and never cached.
+func (c *Cache) Get(ctx context.Context, key string, load func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if v, ok := c.store.Get(key); ok {
+		if nf, ok := v.(notFound); ok {
+			atomic.AddUint64(&c.negativeHits, 1)
+			return nil, nf.err
+		}
+
+		atomic.AddUint64(&c.hits, 1)
+		return v, nil
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+
+	// The load is shared, so it must not fail when the caller that started it goes away.
+	// It keeps the values of that caller's context, like its request ID, for logs.
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(detached{ctx}, c.conf.LoadTimeout)
+		defer cancel()
+
+		generation := atomic.LoadUint64(&c.generation)
+
+		v, err := load(loadCtx)
+
+		if generation != atomic.LoadUint64(&c.generation) {
+			return v, err
+		}
+
+		switch {
+		case err == nil:
+			c.store.Set(key, v, c.conf.TTL)
+		case c.conf.NegativeTTL > 0 && c.isNotFound(err):
+			c.store.Set(key, notFound{err}, c.conf.NegativeTTL)
+		}
+
+		return v, err
+	})
+
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// GetMany returns the values cached for keys and calls load once with the keys that are not cached.
+// load returns the values it found by key, keys it leaves out are stored as not found with missing,
+// which should be the error Get returns for them. Keys of the result are the keys that were found.
+// Unlike Get, concurrent loads of the same keys are not merged.
+func (c *Cache) GetMany(ctx context.Context, keys []string, missing error, load func(ctx context.Context, keys []string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	res := make(map[string]interface{}, len(keys))
+	seen := make(map[string]bool, len(keys))
+	var misses []string
+
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		v, ok := c.store.Get(key)
+		switch {
+		case !ok:
+			atomic.AddUint64(&c.misses, 1)
+			misses = append(misses, key)
+		case isNegative(v):
+			atomic.AddUint64(&c.negativeHits, 1)
+		default:
+			atomic.AddUint64(&c.hits, 1)
+			res[key] = v
+		}
+	}
+
+	if len(misses) == 0 {
+		return res, nil
+	}
+
+	generation := atomic.LoadUint64(&c.generation)
+
+	loaded, err := load(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+
+	store := generation == atomic.LoadUint64(&c.generation)
+
+	for _, key := range misses {
+		v, ok := loaded[key]
+		switch {
+		case ok:
+			res[key] = v
+			if store {
+				c.store.Set(key, v, c.conf.TTL)
+			}
+		case store && c.conf.NegativeTTL > 0 && c.isNotFound(missing):
+			c.store.Set(key, notFound{missing}, c.conf.NegativeTTL)
+		}
+	}
+
+	return res, nil
+}
+
+func isNegative(v interface{}) bool {
+	_, ok := v.(notFound)
+	return ok
+}
+
+// Invalidate drops key from the cache. An empty key drops everything.
+func (c *Cache) Invalidate(key string) {
+	atomic.AddUint64(&c.generation, 1)
+
+	if key == "" {
+		c.store.Flush()
+		return
+	}
+
+	c.store.Delete(key)
+	c.group.Forget(key)
+}
+
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Name:         c.name,
+		Hits:         atomic.LoadUint64(&c.hits),
+		NegativeHits: atomic.LoadUint64(&c.negativeHits),
+		Misses:       atomic.LoadUint64(&c.misses),
+		Items:        c.store.ItemCount(),
+	}
+}
+
+// detached is a context with the values of its parent but not its deadline or cancellation.
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (d detached) Done() <-chan struct{}             { return nil }
+func (d detached) Err() error                        { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+)
+
+type statsResult struct {
+	OK     bool    `json:"ok"`
+	Caches []Stats `json:"caches"`
+}
+
+// StatsHandler serves hit and miss counters of caches as JSON.
+func StatsHandler(caches ...*Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			response.Error(w, r, errors.E(errors.KindMethodNotAllowed, "only GET requests are supported"))
+			return
+		}
+
+		res := statsResult{
+			OK:     true,
+			Caches: make([]Stats, len(caches)),
+		}
+
+		for i, c := range caches {
+			res.Caches[i] = c.Stats()
+		}
+
+		body, err := json.Marshal(res)
+		if err != nil {
+			response.Error(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
+			return
+		}
+
+		response.JSON(w, body, http.StatusOK)
+	})
+}
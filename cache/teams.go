@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+)
+
+type teamsRepository struct {
+	repo  rpc.SlackTeamsRepository
+	cache *Cache
+}
+
+// NewTeamsRepository caches teams found by ID. Cache keys are Slack team IDs.
+func NewTeamsRepository(repo rpc.SlackTeamsRepository, cache *Cache) rpc.SlackTeamsRepository {
+	return &teamsRepository{
+		repo:  repo,
+		cache: cache,
+	}
+}
+
+func (r *teamsRepository) FindTeamByID(ctx context.Context, teamID string) (*rpc.SlackTeam, error) {
+	v, err := r.cache.Get(ctx, teamID, func(ctx context.Context) (interface{}, error) {
+		return r.repo.FindTeamByID(ctx, teamID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*rpc.SlackTeam), nil
+}
+
+// SearchTeams is not cached, search results depend on too many parameters to be reused.
+func (r *teamsRepository) SearchTeams(ctx context.Context, query rpc.TeamSearchQuery) (*rpc.TeamSearchResult, error) {
+	return r.repo.SearchTeams(ctx, query)
+}
@@ -0,0 +1,155 @@
+// Package certs serves TLS certificates that are reloaded when their files change, and verifies client certificates.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Reloader keeps a certificate and its key loaded from files, servers get it with GetCertificate.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader loads the key pair, it fails when the files are not a valid key pair.
+func NewReloader(certFile string, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate is for tls.Config.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Run checks the files every interval until ctx is done and loads them when either changed.
+// A pair that fails to load is logged and the previous one is kept, as files are often
+// replaced one after the other.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		modTime, err := r.lastModified()
+		if err != nil {
+			log.WithError(err).Warn("Failed to check TLS certificate files")
+			continue
+		}
+
+		r.mu.RLock()
+		changed := !modTime.Equal(r.modTime)
+		r.mu.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := r.reload(); err != nil {
+			log.WithError(err).Error("Failed to reload TLS certificate, the previous one is kept")
+			continue
+		}
+
+		log.WithField("certFile", r.certFile).Info("TLS certificate reloaded")
+	}
+}
+
+func (r *Reloader) reload() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return nil
+}
+
+// lastModified is the newest modification time of both files.
+func (r *Reloader) lastModified() (time.Time, error) {
+	var res time.Time
+
+	for _, name := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if fi.ModTime().After(res) {
+			res = fi.ModTime()
+		}
+	}
+
+	return res, nil
+}
+
+// LoadCAs reads PEM certificates of the CAs that sign client certificates.
+func LoadCAs(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates in %s", file)
+	}
+
+	return pool, nil
+}
+
+// ServerConfig serves the certificate of r. With clientCAs, client certificates are verified against them,
+// and required when requireClientCert is set; otherwise clients without one may still use tokens.
+func ServerConfig(r *Reloader, clientCAs *x509.CertPool, requireClientCert bool) *tls.Config {
+	conf := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+
+	if clientCAs != nil {
+		conf.ClientCAs = clientCAs
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return conf
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/crgimenes/goconfig"
 )
@@ -13,7 +14,35 @@ func LoadConfig() (config Config, err error) {
 		return config, err
 	}
 
-	return config, validateEnv(config)
+	if err := validateEnv(config); err != nil {
+		return config, err
+	}
+
+	if _, err := config.Access.ParseUsers(); err != nil {
+		return config, err
+	}
+
+	if _, err := config.RateLimit.ParseRoutes(); err != nil {
+		return config, err
+	}
+
+	if _, err := config.CORS.ParseRoutes(); err != nil {
+		return config, err
+	}
+
+	if err := config.TLS.validate(); err != nil {
+		return config, err
+	}
+
+	if err := config.Events.validate(); err != nil {
+		return config, err
+	}
+
+	if _, err := config.TLS.ParseClientUsers(); err != nil {
+		return config, err
+	}
+
+	return config, config.Slack.validate()
 }
 
 func validateEnv(config Config) error {
@@ -35,21 +64,325 @@ type Config struct {
 	Amqp       AmqpConfig
 	BotUser    User `cfgRequired:"true"`
 	MeteorUser User `cfgRequired:"true"`
+	Access     AccessConfig
+
+	Authorizations AuthorizationsConfig
+	Cache          CacheConfig
+	Icons          IconsConfig
+	Events         EventsConfig
+	RateLimit      RateLimitConfig
+	Health         HealthConfig
+	Dashboard      DashboardConfig
+	CORS           CORSConfig
+	AccessLog      AccessLogConfig
+	TLS            TLSConfig
+	Slack          SlackConfig
 }
 
 type User struct {
 	Token string
 	Name  string
+	// Roles is a comma-separated list of roles of the user, the name is the only role when it is empty.
+	Roles string
+}
+
+type AccessConfig struct {
+	// Users is a comma-separated list of extra API users as name:role|role:token.
+	Users string
+	// RPCRole is the role of RPC requests that come without a token in the authorization header.
+	// The default only reads teams, which is what callers from before tokens need.
+	RPCRole string `cfgDefault:"reader"`
+	// DenyAnonymousRPC denies RPC requests without a token instead. It breaks callers that send none.
+	DenyAnonymousRPC bool
+}
+
+// ParseUsers reads Users.
+func (c AccessConfig) ParseUsers() ([]User, error) {
+	var res []User
+
+	for i, item := range SplitList(c.Users) {
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			// The item is not printed as it may hold a token.
+			return nil, fmt.Errorf("access user #%d must be name:role|role:token", i+1)
+		}
+
+		res = append(res, User{
+			Name:  parts[0],
+			Roles: strings.Replace(parts[1], "|", ",", -1),
+			Token: parts[2],
+		})
+	}
+
+	return res, nil
 }
 
 type MongoDBConfig struct {
 	URI string `cfgRequired:"true"`
+	// AutoMigrate applies pending migrations on start, the server does not start while some are pending otherwise.
+	AutoMigrate bool
+	// StrictIndexes makes index conflicts fatal on start: declared indexes that cannot be
+	// created and hot queries scanning a whole collection. Failing to reach Mongo never is.
+	StrictIndexes bool `cfgDefault:"true"`
 }
 
 type AmqpConfig struct {
 	URI string `cfgRequired:"true"`
 }
 
+type AuthorizationsConfig struct {
+	// DuplicateRules is a comma-separated list of rules used, in order of precedence,
+	// to pick one authorization when a team has several enabled ones.
+	DuplicateRules string `cfgDefault:"scopes,bot,newest"`
+	// RequiredScopes is a comma-separated list of scopes the bot relies on.
+	RequiredScopes string
+	// JournalRetention is how many seconds changes of authorizations are kept for delta sync.
+	// Clients with an older cursor have to fetch all authorizations again.
+	JournalRetention int `cfgDefault:"604800"`
+}
+
+type CacheConfig struct {
+	Enabled bool `cfgDefault:"true"`
+	// TTL of found teams and authorizations, in seconds.
+	TTL int `cfgDefault:"60"`
+	// NegativeTTL of not found results, in seconds. Zero disables negative caching.
+	NegativeTTL int `cfgDefault:"10"`
+}
+
+type IconsConfig struct {
+	// CacheDir is where resized icons are stored.
+	CacheDir string `cfgDefault:"/tmp/slackteams-api/icons"`
+	// CacheMaxAge is how many seconds a resized icon is kept, CacheMaxMB how many megabytes
+	// the cache may take. Zero leaves a bound out.
+	CacheMaxAge int `cfgDefault:"604800"`
+	CacheMaxMB  int `cfgDefault:"512"`
+	// MaxSize is the largest icon size in pixels that can be requested.
+	MaxSize int `cfgDefault:"1024"`
+	// PublicURL is the base URL clients reach this API at. When set, teams
+	// without a custom icon point at generated placeholders.
+	PublicURL string
+}
+
+type EventsConfig struct {
+	// Heartbeat is how often in seconds an idle event stream gets a comment to keep it open.
+	Heartbeat int `cfgDefault:"15"`
+	// Buffer is how many events a connection may fall behind before it is dropped.
+	Buffer int `cfgDefault:"64"`
+}
+
+func (c EventsConfig) validate() error {
+	switch {
+	case c.Heartbeat <= 0:
+		return fmt.Errorf("Events Heartbeat must be positive")
+	case c.Buffer < 0:
+		return fmt.Errorf("Events Buffer must not be negative")
+	}
+
+	return nil
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	// Store keeps buckets and quotas: memory limits every instance on its own, mongo limits them together.
+	Store string `cfgDefault:"memory"`
+	// PerMinute is how many requests a caller may make to a route per minute on average.
+	PerMinute int `cfgDefault:"600"`
+	// Burst is how many requests a caller may make to a route at once.
+	Burst int `cfgDefault:"100"`
+	// Routes is a comma-separated list of limits of routes as pattern=perMinute:burst.
+	Routes string
+	// DailyQuota is how many requests a caller may make a day over all routes. Zero disables quotas.
+	DailyQuota int
+}
+
+// RouteLimit is a limit of Routes.
+type RouteLimit struct {
+	Route     string
+	PerMinute int
+	Burst     int
+}
+
+// ParseRoutes reads Routes.
+func (c RateLimitConfig) ParseRoutes() ([]RouteLimit, error) {
+	var res []RouteLimit
+
+	for _, item := range SplitList(c.Routes) {
+		var limit RouteLimit
+
+		eq := strings.LastIndex(item, "=")
+		if eq > 0 {
+			limit.Route = item[:eq]
+			_, err := fmt.Sscanf(item[eq+1:], "%d:%d", &limit.PerMinute, &limit.Burst)
+			if err == nil && limit.PerMinute >= 0 && limit.Burst > 0 {
+				res = append(res, limit)
+				continue
+			}
+		}
+
+		return nil, fmt.Errorf("rate limit of route '%s' must be pattern=perMinute:burst", item)
+	}
+
+	return res, nil
+}
+
+type CORSConfig struct {
+	// Origins is a comma-separated allowlist of origins browsers may call the API from,
+	// like https://app.standuply.com. https://*.standuply.com allows subdomains, * any origin.
+	Origins string
+	// Methods and Headers are comma-separated lists of what cross-origin requests may send.
+	Methods string `cfgDefault:"GET,HEAD,POST"`
+	Headers string `cfgDefault:"Authorization,Content-Type,X-Auth-Token,X-Language,X-Request-ID"`
+	// ExposedHeaders is a comma-separated list of response headers scripts may read.
+	ExposedHeaders string `cfgDefault:"X-Request-ID,ETag,Retry-After,X-RateLimit-Limit,X-RateLimit-Remaining,X-Quota-Limit,X-Quota-Remaining"`
+	// Credentials lets browsers send cookies, it cannot be combined with the * origin.
+	Credentials bool
+	// MaxAge is how many seconds browsers may cache preflight responses.
+	MaxAge int `cfgDefault:"600"`
+	// Routes is a comma-separated list of origins of routes as pattern=origin|origin, they replace
+	// Origins for the route. A route without origins, like /v1/authorizations=, allows none.
+	Routes string
+}
+
+// CORSRoute is an item of Routes.
+type CORSRoute struct {
+	Route   string
+	Origins []string
+}
+
+// ParseRoutes reads Routes.
+func (c CORSConfig) ParseRoutes() ([]CORSRoute, error) {
+	var res []CORSRoute
+
+	for _, item := range SplitList(c.Routes) {
+		eq := strings.LastIndex(item, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("CORS origins of route '%s' must be pattern=origin|origin", item)
+		}
+
+		route := CORSRoute{Route: item[:eq]}
+		for _, origin := range strings.Split(item[eq+1:], "|") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				route.Origins = append(route.Origins, origin)
+			}
+		}
+
+		res = append(res, route)
+	}
+
+	return res, nil
+}
+
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM files of the certificate and key of the server, they turn HTTPS on.
+	// The files are reloaded when they change.
+	CertFile string
+	KeyFile  string
+	// ReloadInterval is how many seconds apart the files are checked for changes.
+	ReloadInterval int `cfgDefault:"60"`
+	// ClientCAFile is a PEM file of CAs client certificates are verified against, it turns mutual TLS on.
+	ClientCAFile string
+	// RequireClientCert rejects clients without a valid certificate, otherwise they may use tokens.
+	RequireClientCert bool
+	// ClientUsers is a comma-separated list of users of client certificates as commonName:role|role,
+	// where commonName is the CN of the certificate subject.
+	ClientUsers string
+}
+
+func (c TLSConfig) validate() error {
+	switch {
+	case (c.CertFile == "") != (c.KeyFile == ""):
+		return fmt.Errorf("TLS needs both CertFile and KeyFile")
+	case c.ClientCAFile != "" && c.CertFile == "":
+		return fmt.Errorf("TLS ClientCAFile needs CertFile and KeyFile")
+	case c.RequireClientCert && c.ClientCAFile == "":
+		return fmt.Errorf("TLS RequireClientCert needs ClientCAFile")
+	case c.ReloadInterval <= 0:
+		return fmt.Errorf("TLS ReloadInterval must be positive")
+	}
+
+	return nil
+}
+
+// ParseClientUsers reads ClientUsers.
+func (c TLSConfig) ParseClientUsers() ([]User, error) {
+	var res []User
+
+	for _, item := range SplitList(c.ClientUsers) {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("TLS client user '%s' must be commonName:role|role", item)
+		}
+
+		res = append(res, User{
+			Name:  parts[0],
+			Roles: strings.Replace(parts[1], "|", ",", -1),
+		})
+	}
+
+	return res, nil
+}
+
+type SlackConfig struct {
+	// ClientID and ClientSecret are credentials of the Slack app, the ID turns the install routes on.
+	ClientID     string
+	ClientSecret string
+	// APIURL is the base URL of the Slack Web API and AuthorizeURL where users approve installs.
+	APIURL       string `cfgDefault:"https://slack.com/api"`
+	AuthorizeURL string `cfgDefault:"https://slack.com/oauth/v2/authorize"`
+	// Scopes and UserScopes are comma-separated scopes of the bot and of the installing user.
+	Scopes     string
+	UserScopes string
+	// RedirectURL is the public URL of /slack/oauth/callback, the one of the app is used when it is empty.
+	RedirectURL string
+	// StateSecret signs OAuth states, StateTTL is how many seconds users have to approve an install.
+	StateSecret string
+	StateTTL    int `cfgDefault:"600"`
+	// SuccessURL is where users go after an install, they get a plain page when it is empty.
+	SuccessURL string
+	// BotTokenAsAccessToken stores the bot token as accessToken of installs without a user token,
+	// as the bot reads that field. Otherwise accessToken stays empty for them.
+	BotTokenAsAccessToken bool `cfgDefault:"true"`
+	// SigningSecret verifies requests of the Events API, it turns /slack/events on.
+	SigningSecret string
+	// EventsExchange is the RabbitMQ exchange install and uninstall events are published to.
+	EventsExchange string `cfgDefault:"slackTeams.events"`
+}
+
+func (c SlackConfig) validate() error {
+	switch {
+	case c.ClientID == "":
+		return nil
+	case c.ClientSecret == "":
+		return fmt.Errorf("Slack ClientID needs ClientSecret")
+	case c.Scopes == "":
+		return fmt.Errorf("Slack ClientID needs Scopes")
+	case c.StateSecret == "":
+		return fmt.Errorf("Slack ClientID needs StateSecret")
+	case c.StateTTL <= 0:
+		return fmt.Errorf("Slack StateTTL must be positive")
+	}
+
+	return nil
+}
+
+type AccessLogConfig struct {
+	Enabled bool `cfgDefault:"true"`
+	// Skip is a comma-separated list of route patterns that are not logged.
+	Skip string `cfgDefault:"/healthz,/readyz,/metrics"`
+}
+
+type HealthConfig struct {
+	// MongoTimeout is how many milliseconds /readyz waits for Mongo to answer a ping.
+	MongoTimeout int `cfgDefault:"800"`
+	// AmqpTimeout is how many milliseconds /readyz waits for the state of RabbitMQ.
+	AmqpTimeout int `cfgDefault:"200"`
+}
+
+type DashboardConfig struct {
+	// Activity is how many recent requests the dashboard shows.
+	Activity int `cfgDefault:"500"`
+}
+
 type EnvType string
 
 const (
@@ -57,3 +390,16 @@ const (
 	EnvTypeStage       EnvType = "stage"
 	EnvTypeProduction  EnvType = "production"
 )
+
+// SplitList splits a comma-separated config value, dropping empty items.
+func SplitList(value string) []string {
+	var res []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
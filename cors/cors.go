@@ -0,0 +1,244 @@
+// Package cors lets browsers on allowed origins call the API, with a policy per route.
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errOriginNotAllowed = errors.E(errors.KindForbidden, "CORS origin not allowed")
+	errMethodNotAllowed = errors.E(errors.KindForbidden, "CORS method not allowed")
+	errHeaderNotAllowed = errors.E(errors.KindForbidden, "CORS header not allowed")
+)
+
+// AnyOrigin allows every origin.
+const AnyOrigin = "*"
+
+// Policy tells which origins may call a route and how.
+type Policy struct {
+	// Origins are allowed origins, like https://app.example.com. https://*.example.com allows
+	// subdomains of example.com and AnyOrigin every origin. No origins allow none.
+	Origins []string
+	// Methods and Headers are what browsers may send in cross-origin requests.
+	Methods []string
+	Headers []string
+	// ExposedHeaders are response headers scripts may read.
+	ExposedHeaders []string
+	// Credentials lets browsers send cookies and scripts read responses to them.
+	Credentials bool
+	// MaxAge is how long browsers may cache a preflight response, zero leaves it to them.
+	MaxAge time.Duration
+}
+
+// Validate rejects policies browsers would not honour.
+func (p Policy) Validate() error {
+	for _, origin := range p.Origins {
+		if origin == AnyOrigin {
+			if p.Credentials {
+				return fmt.Errorf("CORS origin %s cannot be allowed with credentials", AnyOrigin)
+			}
+			continue
+		}
+
+		scheme, host := splitOrigin(origin)
+		if scheme == "" || host == "" || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf("CORS origin '%s' must be scheme://host[:port] or scheme://*.host[:port]", origin)
+		}
+	}
+
+	return nil
+}
+
+type Config struct {
+	Default Policy
+	// Routes are policies of route patterns, like /v1/teams/{teamId}/icon.
+	Routes map[string]Policy
+	// Route returns the pattern of the route of a request path, or an empty string.
+	// Preflight requests never reach a route, so it cannot be told after routing.
+	Route func(path string) string
+}
+
+// CORS answers preflight requests and adds CORS headers to responses of allowed origins.
+type CORS struct {
+	conf Config
+}
+
+func New(conf Config) *CORS {
+	return &CORS{conf}
+}
+
+// Middleware applies the policy of the route of a request. Requests of origins that are not allowed
+// get no CORS headers, so browsers do not let scripts read responses, and preflights of them fail.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		policy, route := c.policy(r)
+
+		if len(policy.Origins) > 0 {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		// Browsers send the origin with same-origin requests too, like posts of the dashboard.
+		if origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !policy.allowsOrigin(origin) {
+			c.reject(w, r, route, preflight, errOriginNotAllowed)
+			if !preflight {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+
+		if preflight {
+			c.preflight(w, r, route, policy)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", policy.allowOrigin(origin))
+		if policy.Credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if len(policy.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request, route string, policy Policy) {
+	if method := r.Header.Get("Access-Control-Request-Method"); !contains(policy.Methods, method) {
+		c.reject(w, r, route, true, errMethodNotAllowed)
+		return
+	}
+
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.TrimSpace(header); header != "" && !contains(policy.Headers, header) {
+			c.reject(w, r, route, true, errHeaderNotAllowed)
+			return
+		}
+	}
+
+	origin := r.Header.Get("Origin")
+
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	h.Set("Access-Control-Allow-Origin", policy.allowOrigin(origin))
+	h.Set("Access-Control-Allow-Methods", strings.Join(policy.Methods, ", "))
+	if len(policy.Headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(policy.Headers, ", "))
+	}
+	if policy.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if policy.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge/time.Second)))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reject logs a request of a browser that is not allowed and answers preflights with err.
+func (c *CORS) reject(w http.ResponseWriter, r *http.Request, route string, preflight bool, err error) {
+	log.WithContext(r.Context()).WithFields(log.Fields{
+		"origin":    r.Header.Get("Origin"),
+		"route":     route,
+		"method":    r.Header.Get("Access-Control-Request-Method"),
+		"headers":   r.Header.Get("Access-Control-Request-Headers"),
+		"preflight": preflight,
+	}).Info(err.Error())
+
+	if preflight {
+		response.Error(w, r, err)
+	}
+}
+
+func (c *CORS) policy(r *http.Request) (Policy, string) {
+	var route string
+	if c.conf.Route != nil {
+		route = c.conf.Route(r.URL.Path)
+	}
+
+	if p, ok := c.conf.Routes[route]; ok && route != "" {
+		return p, route
+	}
+
+	return c.conf.Default, route
+}
+
+func (p Policy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.Origins {
+		if allowed == AnyOrigin || matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowOrigin is the Access-Control-Allow-Origin of an allowed origin: * when any origin is allowed
+// without credentials, the origin itself otherwise, which is why responses vary by Origin.
+func (p Policy) allowOrigin(origin string) string {
+	if contains(p.Origins, AnyOrigin) && !p.Credentials {
+		return AnyOrigin
+	}
+
+	return origin
+}
+
+// matchOrigin tells whether origin is allowed by pattern, schemes and hosts are case-insensitive.
+func matchOrigin(pattern string, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	if pattern == origin {
+		return true
+	}
+
+	pScheme, pHost := splitOrigin(pattern)
+	oScheme, oHost := splitOrigin(origin)
+	if pScheme != oScheme || !strings.HasPrefix(pHost, "*.") {
+		return false
+	}
+
+	suffix := pHost[1:]
+
+	return strings.HasSuffix(oHost, suffix) && len(oHost) > len(suffix) && !strings.Contains(oHost[:len(oHost)-len(suffix)], "/")
+}
+
+func splitOrigin(origin string) (scheme string, host string) {
+	i := strings.Index(origin, "://")
+	if i <= 0 {
+		return "", ""
+	}
+
+	return origin[:i], origin[i+3:]
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameOrigin(r *http.Request, origin string) bool {
+	_, host := splitOrigin(origin)
+	return strings.EqualFold(host, r.Host)
+}
@@ -0,0 +1,64 @@
+package dashboard
+
+// stylesheet is served at /admin/assets/dashboard.css. The dashboard has no scripts.
+const stylesheet = `
+* { box-sizing: border-box; }
+
+body {
+	margin: 0;
+	font: 14px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif;
+	color: #1d1c1d;
+	background: #f8f8f8;
+}
+
+header {
+	display: flex;
+	align-items: center;
+	gap: 24px;
+	padding: 12px 24px;
+	background: #3f0e40;
+	color: #fff;
+}
+
+header a { color: #fff; text-decoration: none; }
+header .brand { font-weight: 700; }
+header nav { display: flex; gap: 16px; flex: 1; }
+header .logout { display: flex; align-items: center; gap: 12px; margin: 0; }
+
+main { max-width: 1200px; margin: 0 auto; padding: 24px; }
+
+h1 { font-size: 22px; margin: 0 0 12px; }
+h2 { font-size: 17px; margin: 24px 0 8px; }
+
+a { color: #1264a3; }
+
+table { width: 100%; border-collapse: collapse; background: #fff; }
+th, td { padding: 8px 10px; border-bottom: 1px solid #e8e8e8; text-align: left; vertical-align: middle; }
+th { font-weight: 600; background: #f2f2f2; }
+tr.deleted td { opacity: .5; }
+
+dl { display: grid; grid-template-columns: max-content auto; gap: 4px 16px; margin: 0; }
+dt { color: #616061; }
+dd { margin: 0; }
+
+code { font: 12px/1.4 Menlo, Consolas, monospace; background: #f2f2f2; padding: 1px 4px; border-radius: 3px; }
+
+input, button { font: inherit; padding: 6px 10px; border: 1px solid #bbb; border-radius: 4px; }
+button { background: #007a5a; border-color: #007a5a; color: #fff; cursor: pointer; }
+header button { background: transparent; border-color: #fff; }
+
+.search { display: flex; gap: 8px; margin-bottom: 8px; }
+.search input { flex: 1; }
+
+.login { max-width: 360px; margin: 64px auto; display: flex; flex-direction: column; gap: 12px; }
+
+.team { display: flex; gap: 24px; align-items: flex-start; }
+.icon { border-radius: 6px; background: #e8e8e8; }
+
+.pages { display: flex; justify-content: space-between; }
+
+.muted { color: #616061; }
+.ok { color: #007a5a; }
+.warn { color: #b97a00; font-weight: 600; }
+.bad { color: #c4153b; }
+`
@@ -0,0 +1,413 @@
+// Package dashboard serves the admin web dashboard: teams, their authorizations
+// and duplicates, and recent activity. Pages are rendered on the server with
+// html/template, the stylesheet is kept in the binary.
+package dashboard
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/activity"
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	"bitbucket.org/iwlab-standuply/slackteams-api/router"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// Path is where the dashboard is served.
+const Path = "/admin"
+
+type Config struct {
+	Teams    rpc.SlackTeamsRepository
+	Auths    handler.AuthorizationsRepository
+	Resolver *handler.DuplicatesResolver
+	Auth     auth.Service
+	Activity *activity.Log
+}
+
+type Dashboard struct {
+	conf     Config
+	pages    map[string]*template.Template
+	sessions *sessions
+}
+
+func New(conf Config) (*Dashboard, error) {
+	pages := map[string]*template.Template{}
+
+	for name, page := range pageTemplates {
+		t, err := template.New(name).Funcs(funcs).Parse(layoutTemplate)
+		if err == nil {
+			_, err = t.Parse(page)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		pages[name] = t
+	}
+
+	return &Dashboard{
+		conf:     conf,
+		pages:    pages,
+		sessions: newSessions(),
+	}, nil
+}
+
+var funcs = template.FuncMap{
+	"mask": handler.MaskToken,
+	"time": func(v interface{}) string {
+		var t time.Time
+		switch v := v.(type) {
+		case time.Time:
+			t = v
+		case *time.Time:
+			if v != nil {
+				t = *v
+			}
+		}
+
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02 15:04:05")
+	},
+	"ms": func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds()*1000, 'f', 1, 64) + " ms"
+	},
+	"tags": func(tags *[]string) string {
+		if tags == nil {
+			return ""
+		}
+		return strings.Join(*tags, ", ")
+	},
+	"iconURL": func(teamID string, size int) string {
+		return "/v1/teams/" + url.PathEscape(teamID) + "/icon?size=" + strconv.Itoa(size)
+	},
+	"pathEscape": url.PathEscape,
+}
+
+// page is what every page gets, Data is specific to the page.
+type page struct {
+	Title     string
+	Principal *auth.Principal
+	Data      interface{}
+}
+
+// RequireLogin loads the principal of the session cookie, unless the request carried a token or
+// client certificate. It sends visitors without a session to the login page and answers 403
+// to those who may not view the dashboard.
+func (d *Dashboard) RequireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			if token, found := d.sessions.token(r); found {
+				if sp, err := d.conf.Auth.FindPrincipalByToken(r.Context(), token); err == nil {
+					p, ok = sp, true
+					r = r.WithContext(auth.WithPrincipal(r.Context(), p))
+				}
+			}
+		}
+		if !ok {
+			http.Redirect(w, r, Path+"/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+
+		if !p.Can(auth.PermViewDashboard) {
+			d.renderError(w, r, errors.E(errors.KindForbidden, "your token may not view the dashboard"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type teamRow struct {
+	Team          *rpc.SlackTeam
+	Authorization *handler.SlackBotAuthorization
+	Duplicates    int
+}
+
+type teamsData struct {
+	Query    string
+	Teams    []teamRow
+	Total    int64
+	Offset   int
+	Limit    int
+	PrevPage string
+	NextPage string
+}
+
+// Teams lists teams found by the q param, with their authorizations.
+func (d *Dashboard) Teams() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		query := rpc.TeamSearchQuery{
+			Query:  strings.TrimSpace(r.URL.Query().Get("q")),
+			Offset: offset,
+		}.Normalize()
+
+		res, err := d.conf.Teams.SearchTeams(ctx, query)
+		if err != nil {
+			d.renderError(w, r, errors.WithKind(err, errors.KindInternal, "failed to search teams"))
+			return
+		}
+
+		duplicates, err := d.duplicates(r)
+		if err != nil {
+			d.renderError(w, r, err)
+			return
+		}
+
+		data := teamsData{
+			Query:  query.Query,
+			Total:  res.Total,
+			Offset: query.Offset,
+			Limit:  query.Limit,
+		}
+
+		teamIDs := make([]string, len(res.Teams))
+		for i, t := range res.Teams {
+			teamIDs[i] = t.ID
+		}
+
+		batch, err := d.conf.Auths.GetAuthorizations(ctx, teamIDs)
+		if err != nil {
+			d.renderError(w, r, errors.WithKind(err, errors.KindInternal, "failed to get authorizations"))
+			return
+		}
+
+		auths := make(map[string]*handler.SlackBotAuthorization, len(batch.Authorizations))
+		for _, a := range batch.Authorizations {
+			auths[a.TeamId] = a
+		}
+
+		for _, t := range res.Teams {
+			row := teamRow{Team: t, Authorization: auths[t.ID]}
+
+			if report, ok := duplicates[t.ID]; ok {
+				row.Duplicates = len(report.Candidates)
+			}
+
+			data.Teams = append(data.Teams, row)
+		}
+
+		if query.Offset > 0 {
+			data.PrevPage = pageURL(query.Query, query.Offset-query.Limit)
+		}
+		if int64(query.Offset+query.Limit) < res.Total {
+			data.NextPage = pageURL(query.Query, query.Offset+query.Limit)
+		}
+
+		d.render(w, r, http.StatusOK, "teams", "Teams", data)
+	})
+}
+
+func pageURL(q string, offset int) string {
+	if offset < 0 {
+		offset = 0
+	}
+
+	return Path + "?" + url.Values{"q": {q}, "offset": {strconv.Itoa(offset)}}.Encode()
+}
+
+type teamData struct {
+	Team          *rpc.SlackTeam
+	Authorization *handler.SlackBotAuthorization
+	Duplicates    *handler.DuplicateReport
+}
+
+// Team shows a team with its authorization and duplicates.
+func (d *Dashboard) Team() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		teamID := router.Param(r, "teamId")
+
+		team, err := d.conf.Teams.FindTeamByID(ctx, teamID)
+		if err == handler.ErrNotFound {
+			d.renderError(w, r, errors.E(errors.KindNotFound, "no team "+teamID))
+			return
+		}
+		if err != nil {
+			d.renderError(w, r, errors.WithKind(err, errors.KindInternal, "failed to get the team"))
+			return
+		}
+
+		data := teamData{Team: team}
+
+		data.Authorization, err = d.conf.Auths.GetAuthorization(ctx, teamID)
+		if err != nil && err != handler.ErrNotFound {
+			d.renderError(w, r, errors.WithKind(err, errors.KindInternal, "failed to get the authorization"))
+			return
+		}
+
+		duplicates, err := d.duplicates(r)
+		if err != nil {
+			d.renderError(w, r, err)
+			return
+		}
+
+		if report, ok := duplicates[teamID]; ok {
+			data.Duplicates = &report
+		}
+
+		d.render(w, r, http.StatusOK, "team", team.Name, data)
+	})
+}
+
+// Duplicates lists teams with several enabled authorizations.
+func (d *Dashboard) Duplicates() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths, err := d.conf.Auths.GetAllAuthorizations(r.Context())
+		if err != nil {
+			d.renderError(w, r, errors.WithKind(err, errors.KindInternal, "failed to get authorizations"))
+			return
+		}
+
+		d.render(w, r, http.StatusOK, "duplicates", "Duplicates", d.conf.Resolver.Report(auths))
+	})
+}
+
+// Activity shows recent requests of authenticated callers and RPC messages.
+func (d *Dashboard) Activity() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.render(w, r, http.StatusOK, "activity", "Activity", d.conf.Activity.Recent())
+	})
+}
+
+// duplicates reports teams with duplicate authorizations by team ID.
+func (d *Dashboard) duplicates(r *http.Request) (map[string]handler.DuplicateReport, error) {
+	auths, err := d.conf.Auths.GetAllAuthorizations(r.Context())
+	if err != nil {
+		return nil, errors.WithKind(err, errors.KindInternal, "failed to get authorizations")
+	}
+
+	res := map[string]handler.DuplicateReport{}
+	for _, report := range d.conf.Resolver.Report(auths) {
+		res[report.TeamId] = report
+	}
+
+	return res, nil
+}
+
+type loginData struct {
+	Next  string
+	Error string
+}
+
+// Login signs in with an API token, which is kept in a session of the instance behind a cookie.
+func (d *Dashboard) Login() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := loginData{Next: safeNext(r.FormValue("next"))}
+
+		if r.Method != http.MethodPost {
+			d.render(w, r, http.StatusOK, "login", "Sign in", data)
+			return
+		}
+
+		token := strings.TrimSpace(r.PostFormValue("token"))
+
+		p, err := d.conf.Auth.FindPrincipalByToken(r.Context(), token)
+		if err != nil || token == "" {
+			data.Error = "Unknown token."
+			d.render(w, r, http.StatusUnauthorized, "login", "Sign in", data)
+			return
+		}
+
+		if !p.Can(auth.PermViewDashboard) {
+			data.Error = "This token may not view the dashboard."
+			d.render(w, r, http.StatusForbidden, "login", "Sign in", data)
+			return
+		}
+
+		id, err := d.sessions.start(token)
+		if err != nil {
+			d.renderError(w, r, errors.WithKind(err, errors.KindInternal, "failed to start a session"))
+			return
+		}
+
+		http.SetCookie(w, sessionCookieOf(r, id, int(sessionTTL/time.Second)))
+
+		log.WithContext(r.Context()).WithField("principal", p.Name).Info("Signed in to the dashboard")
+		http.Redirect(w, r, data.Next, http.StatusSeeOther)
+	})
+}
+
+// Logout ends the session and drops its cookie.
+func (d *Dashboard) Logout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.sessions.end(r)
+		http.SetCookie(w, sessionCookieOf(r, "", -1))
+
+		http.Redirect(w, r, Path+"/login", http.StatusSeeOther)
+	})
+}
+
+// Stylesheet serves the stylesheet of the dashboard.
+func (d *Dashboard) Stylesheet() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		http.ServeContent(w, r, "dashboard.css", startedAt, strings.NewReader(stylesheet))
+	})
+}
+
+// startedAt is the modification time of the stylesheet, it changes with the binary.
+var startedAt = time.Now()
+
+// safeNext keeps redirects after sign in within the dashboard.
+func safeNext(next string) string {
+	if next == Path || strings.HasPrefix(next, Path+"/") || strings.HasPrefix(next, Path+"?") {
+		return next
+	}
+
+	return Path
+}
+
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func (d *Dashboard) render(w http.ResponseWriter, r *http.Request, status int, name string, title string, data interface{}) {
+	p, _ := auth.PrincipalFromContext(r.Context())
+
+	var buf bytes.Buffer
+	if err := d.pages[name].ExecuteTemplate(&buf, "layout", page{Title: title, Principal: p, Data: data}); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("Failed to render dashboard page " + name)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' https: data:; form-action 'self'; frame-ancestors 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+type errorData struct {
+	Message string
+}
+
+// renderError is response.Error for pages: the status of the kind and a page instead of JSON.
+func (d *Dashboard) renderError(w http.ResponseWriter, r *http.Request, err error) {
+	kind := errors.KindOf(err)
+	message := errors.MessageOf(err)
+
+	if kind == errors.KindInternal || kind == errors.KindUnavailable {
+		log.WithContext(r.Context()).WithError(err).Errorf("%s %s failed", r.Method, r.URL.Path)
+		message = "Something went wrong, see the logs."
+	}
+
+	d.render(w, r, response.Status(err), "error", "Error", errorData{Message: message})
+}
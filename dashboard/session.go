@@ -0,0 +1,75 @@
+package dashboard
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	sessionCookie = "st_session"
+
+	sessionTTL = 12 * time.Hour
+)
+
+// sessions maps the random IDs in session cookies to the tokens they signed in with, so the cookie
+// is worth nothing once it expires or signs out. They are kept in memory of the instance.
+type sessions struct {
+	tokens *cache.Cache
+}
+
+func newSessions() *sessions {
+	return &sessions{
+		tokens: cache.New(sessionTTL, 10*time.Minute),
+	}
+}
+
+// start keeps token under a new session ID.
+func (s *sessions) start(token string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(b)
+	s.tokens.Set(id, token, cache.DefaultExpiration)
+
+	return id, nil
+}
+
+// token returns the token of the session of r.
+func (s *sessions) token(r *http.Request) (string, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	token, ok := s.tokens.Get(c.Value)
+	if !ok {
+		return "", false
+	}
+
+	return token.(string), true
+}
+
+// end drops the session of r.
+func (s *sessions) end(r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.tokens.Delete(c.Value)
+	}
+}
+
+func sessionCookieOf(r *http.Request, id string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     Path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
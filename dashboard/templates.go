@@ -0,0 +1,176 @@
+package dashboard
+
+// layoutTemplate wraps every page, pages define the content template. It also
+// holds the templates shared by pages.
+const layoutTemplate = `{{define "layout"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>{{.Title}} · Slack teams admin</title>
+	<link rel="stylesheet" href="/admin/assets/dashboard.css">
+</head>
+<body>
+	<header>
+		<a class="brand" href="/admin">Slack teams admin</a>
+		{{if .Principal}}
+		<nav>
+			<a href="/admin">Teams</a>
+			<a href="/admin/duplicates">Duplicates</a>
+			<a href="/admin/activity">Activity</a>
+		</nav>
+		<form class="logout" method="post" action="/admin/logout">
+			<span>{{.Principal.Name}}</span>
+			<button type="submit">Sign out</button>
+		</form>
+		{{end}}
+	</header>
+	<main>
+		{{template "content" .Data}}
+	</main>
+</body>
+</html>{{end}}
+
+{{define "candidates"}}
+<table>
+	<thead>
+		<tr><th>ID</th><th>Installed by</th><th>Scopes</th><th>Created</th><th>Bot token</th></tr>
+	</thead>
+	<tbody>
+	{{range .}}
+		<tr>
+			<td><code>{{.ID}}</code></td>
+			<td><code>{{.UserId}}</code></td>
+			<td>{{.Scope}}</td>
+			<td>{{.CreatedAt}}</td>
+			<td>{{if .HasBotToken}}<span class="ok">yes</span>{{else}}<span class="bad">no</span>{{end}}</td>
+		</tr>
+	{{end}}
+	</tbody>
+</table>
+{{end}}`
+
+var pageTemplates = map[string]string{
+	"teams": `{{define "content"}}
+<form class="search" method="get" action="/admin">
+	<input type="search" name="q" value="{{.Query}}" placeholder="Name, domain or email domain" autofocus>
+	<button type="submit">Search</button>
+</form>
+<p class="muted">{{.Total}} teams</p>
+<table>
+	<thead>
+		<tr><th></th><th>Team</th><th>Domain</th><th>Tags</th><th>Authorization</th><th>Duplicates</th></tr>
+	</thead>
+	<tbody>
+	{{range .Teams}}
+		<tr{{if .Team.IsDeleted}} class="deleted"{{end}}>
+			<td><img class="icon" src="{{iconURL .Team.ID 34}}" alt="" width="34" height="34"></td>
+			<td><a href="/admin/teams/{{pathEscape .Team.ID}}">{{.Team.Name}}</a><div class="muted">{{.Team.ID}}</div></td>
+			<td>{{.Team.Domain}}</td>
+			<td>{{tags .Team.Tags}}</td>
+			<td>{{if .Authorization}}<span class="ok">enabled</span> <code>{{mask .Authorization.Bot.BotAccessToken}}</code>{{else}}<span class="bad">none</span>{{end}}</td>
+			<td>{{if .Duplicates}}<span class="warn">{{.Duplicates}}</span>{{end}}</td>
+		</tr>
+	{{else}}
+		<tr><td colspan="6" class="muted">No teams found.</td></tr>
+	{{end}}
+	</tbody>
+</table>
+<p class="pages">
+	{{if .PrevPage}}<a href="{{.PrevPage}}">&larr; Previous</a>{{end}}
+	{{if .NextPage}}<a href="{{.NextPage}}">Next &rarr;</a>{{end}}
+</p>
+{{end}}`,
+
+	"team": `{{define "content"}}
+<section class="team">
+	<img class="icon" src="{{iconURL .Team.ID 132}}" alt="" width="132" height="132">
+	<div>
+		<h1>{{.Team.Name}}{{if .Team.IsDeleted}} <span class="bad">deleted</span>{{end}}</h1>
+		<dl>
+			<dt>ID</dt><dd><code>{{.Team.ID}}</code></dd>
+			<dt>Domain</dt><dd>{{.Team.Domain}}</dd>
+			<dt>Email domain</dt><dd>{{.Team.EmailDomain}}</dd>
+			<dt>Tags</dt><dd>{{tags .Team.Tags}}</dd>
+			<dt>Created</dt><dd>{{time .Team.CreatedAt}}</dd>
+			{{if .Team.DeletedAt}}<dt>Deleted</dt><dd>{{time .Team.DeletedAt}}</dd>{{end}}
+		</dl>
+	</div>
+</section>
+
+<h2>Authorization</h2>
+{{with .Authorization}}
+<dl>
+	<dt>ID</dt><dd><code>{{.ID}}</code></dd>
+	<dt>Access token</dt><dd><code>{{mask .AccessToken}}</code></dd>
+	<dt>Bot user</dt><dd><code>{{.Bot.BotUserId}}</code></dd>
+	<dt>Bot token</dt><dd><code>{{mask .Bot.BotAccessToken}}</code></dd>
+	<dt>Installed by</dt><dd><code>{{.UserId}}</code></dd>
+	<dt>Scopes</dt><dd>{{.Scope}}</dd>
+	<dt>Created</dt><dd>{{.CreatedAt}}</dd>
+	<dt>Updated</dt><dd>{{.UpdatedAt}}</dd>
+</dl>
+{{else}}
+<p class="bad">The team has no enabled authorization.</p>
+{{end}}
+
+{{with .Duplicates}}
+<h2>Duplicates</h2>
+<p class="muted">The team has {{len .Candidates}} enabled authorizations, the first one is served.</p>
+{{template "candidates" .Candidates}}
+{{end}}
+{{end}}`,
+
+	"duplicates": `{{define "content"}}
+<h1>Duplicates</h1>
+<p class="muted">Teams with several enabled authorizations. The first candidate is the one served to the bot.</p>
+{{range .}}
+<h2><a href="/admin/teams/{{pathEscape .TeamId}}">{{.TeamName}}</a> <span class="muted">{{.TeamId}}</span></h2>
+{{template "candidates" .Candidates}}
+{{else}}
+<p>No team has duplicate authorizations.</p>
+{{end}}
+{{end}}`,
+
+	"activity": `{{define "content"}}
+<h1>Activity</h1>
+<p class="muted">Recent requests of authenticated callers and RPC messages, newest first. Kept in memory of this instance only.</p>
+<table>
+	<thead>
+		<tr><th>At (UTC)</th><th>Kind</th><th>Request</th><th>Caller</th><th>Status</th><th>Duration</th><th>Request ID</th></tr>
+	</thead>
+	<tbody>
+	{{range .}}
+		<tr>
+			<td>{{time .At}}</td>
+			<td>{{.Kind}}</td>
+			<td>{{.Method}} {{.Name}}</td>
+			<td>{{.Principal}}</td>
+			<td>{{if .Failed}}<span class="bad">{{.Status}}</span>{{else}}{{.Status}}{{end}}</td>
+			<td>{{ms .Duration}}</td>
+			<td><code>{{.RequestID}}</code></td>
+		</tr>
+	{{else}}
+		<tr><td colspan="7" class="muted">Nothing yet.</td></tr>
+	{{end}}
+	</tbody>
+</table>
+{{end}}`,
+
+	"login": `{{define "content"}}
+<form class="login" method="post" action="/admin/login">
+	<h1>Sign in</h1>
+	<p class="muted">Use an API token of a user with the admin or support role.</p>
+	{{if .Error}}<p class="bad">{{.Error}}</p>{{end}}
+	<input type="hidden" name="next" value="{{.Next}}">
+	<input type="password" name="token" placeholder="Token" autocomplete="current-password" required autofocus>
+	<button type="submit">Sign in</button>
+</form>
+{{end}}`,
+
+	"error": `{{define "content"}}
+<h1>Error</h1>
+<p class="bad">{{.Message}}</p>
+<p><a href="/admin">Back to teams</a></p>
+{{end}}`,
+}
@@ -0,0 +1,462 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	authChangesCollectionName     = "slack-bot-authorization-changes"
+	authJournalGapsCollectionName = "slack-bot-authorization-journal-gaps"
+
+	// journalGapID is the only document of the gaps collection, it keeps the latest gap.
+	journalGapID = "gap"
+)
+
+// authorizationChange is a journal entry. Entries are ordered by At and then by ID.
+type authorizationChange struct {
+	// ID is the resume token of the change event, so recording an event twice is harmless.
+	ID         string                          `bson:"_id"`
+	Token      bson.Raw                        `bson:"token"`
+	Kind       handler.AuthorizationChangeKind `bson:"kind"`
+	DocumentID string                          `bson:"documentId"`
+	TeamId     string                          `bson:"teamId"`
+	At         primitive.Timestamp             `bson:"at"`
+	RecordedAt time.Time                       `bson:"recordedAt"`
+}
+
+// journalGap is when the journal last lost changes, because the change stream could not resume.
+// Cursors from before it would skip those changes.
+type journalGap struct {
+	At         primitive.Timestamp `bson:"at"`
+	RecordedAt time.Time           `bson:"recordedAt"`
+}
+
+// AuthorizationJournal keeps changes of authorizations read from the change stream
+// for a retention period, so clients can ask what changed since a cursor.
+type AuthorizationJournal struct {
+	client    *mongo.Client
+	db        *mongo.Database
+	retention time.Duration
+}
+
+func NewAuthorizationJournal(uri string, retention time.Duration) *AuthorizationJournal {
+	client, db := connect(uri, "NewAuthorizationJournal")
+
+	return &AuthorizationJournal{
+		client,
+		db,
+		retention,
+	}
+}
+
+func (j *AuthorizationJournal) collectionIndexes() []collectionIndexes {
+	retention := int32(j.retention / time.Second)
+
+	return []collectionIndexes{
+		{
+			Collection: j.db.Collection(authChangesCollectionName),
+			Indexes: []index{
+				{Name: "at_1__id_1", Keys: bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}},
+				{Name: "documentId_1_at_-1", Keys: bson.D{{Key: "documentId", Value: 1}, {Key: "at", Value: -1}}},
+				{Name: "recordedAt_ttl", Keys: bson.D{{Key: "recordedAt", Value: 1}}, ExpireAfter: &retention},
+			},
+			HotQueries: []hotQuery{
+				{Name: "AuthorizationsSince", Filter: bson.D{{Key: "at", Value: bson.M{"$gt": primitive.Timestamp{}}}}},
+			},
+		},
+	}
+}
+
+// Run records changes of authorizations until ctx is done. It resumes after
+// the last recorded change, so changes made while the service was down are not missed.
+// notify, if not nil, is called for every recorded change.
+func (j *AuthorizationJournal) Run(ctx context.Context, streams *ChangeStreams, notify func(change handler.AuthorizationChange)) {
+	resumeAfter, err := j.lastToken(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to read the last recorded authorization change")
+	}
+
+	lost := func() {
+		// Nothing is recorded before the gap is, or clients could sync across it.
+		for {
+			err := j.markGap(ctx, time.Now())
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+
+			log.WithError(err).Error("Failed to record a gap of the authorization journal, retrying")
+			sleepContext(ctx, 5*time.Second)
+		}
+	}
+
+	streams.WatchAuthorizationsFrom(ctx, resumeAfter, lost, func(e ChangeEvent) {
+		entry, err := j.record(ctx, e)
+		if err != nil {
+			log.WithError(err).WithField("documentId", e.DocumentID).Error("Failed to record authorization change")
+			return
+		}
+
+		if entry == nil || notify == nil {
+			return
+		}
+
+		var auth *handler.SlackBotAuthorization
+		if e.FullDocument != nil {
+			var doc slackBotAuthorization
+			if err := bson.Unmarshal(e.FullDocument, &doc); err == nil && doc.Enabled {
+				auth = doc.toAuthorization()
+			}
+		}
+
+		notify(entry.toChange(auth))
+	})
+}
+
+// markGap records that changes until now were lost. Only the latest gap matters, cursors
+// before it are expired.
+func (j *AuthorizationJournal) markGap(ctx context.Context, now time.Time) error {
+	_, err := j.db.Collection(authJournalGapsCollectionName).UpdateOne(ctx,
+		bson.M{"_id": journalGapID},
+		bson.M{
+			"$max": bson.M{"at": primitive.Timestamp{T: uint32(now.Unix())}},
+			"$set": bson.M{"recordedAt": now.UTC()},
+		},
+		options.Update().SetUpsert(true),
+	)
+
+	return err
+}
+
+// gap returns the time of the latest gap, zero when the journal never lost changes.
+func (j *AuthorizationJournal) gap(ctx context.Context) (primitive.Timestamp, error) {
+	var g journalGap
+
+	err := j.db.Collection(authJournalGapsCollectionName).FindOne(ctx, bson.M{"_id": journalGapID}).Decode(&g)
+	if err == mongo.ErrNoDocuments {
+		return primitive.Timestamp{}, nil
+	}
+
+	return g.At, err
+}
+
+// record writes the change of e to the journal, it returns nil for events that change no authorization.
+func (j *AuthorizationJournal) record(ctx context.Context, e ChangeEvent) (*authorizationChange, error) {
+	change := authorizationChange{
+		ID:         tokenID(e.ResumeToken),
+		Token:      e.ResumeToken,
+		Kind:       changeKind(e),
+		DocumentID: e.DocumentID,
+		TeamId:     e.TeamID,
+		At:         e.ClusterTime,
+		RecordedAt: time.Now(),
+	}
+
+	if change.Kind == "" {
+		return nil, nil
+	}
+
+	// Deleted documents are gone, take the team from an earlier change.
+	if change.TeamId == "" {
+		var prev authorizationChange
+
+		opts := options.FindOne().SetSort(bson.D{{Key: "at", Value: -1}})
+		err := j.db.Collection(authChangesCollectionName).FindOne(ctx, bson.M{"documentId": e.DocumentID}, opts).Decode(&prev)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+
+		change.TeamId = prev.TeamId
+	}
+
+	_, err := j.db.Collection(authChangesCollectionName).UpdateOne(ctx,
+		bson.M{"_id": change.ID},
+		bson.M{"$setOnInsert": change},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// toChange makes the change clients see. auth is only kept for changes of authorizations that are still enabled.
+func (c *authorizationChange) toChange(auth *handler.SlackBotAuthorization) handler.AuthorizationChange {
+	res := handler.AuthorizationChange{
+		Kind:   c.Kind,
+		ID:     c.DocumentID,
+		TeamId: c.TeamId,
+		At:     time.Unix(int64(c.At.T), 0).UTC(),
+		Cursor: encodeCursor(c.At, c.ID),
+	}
+
+	if c.Kind != handler.ChangeRemoved && c.Kind != handler.ChangeDisabled {
+		res.Auth = auth
+	}
+
+	return res
+}
+
+// changeKind classifies an event, it returns an empty kind for events that are not changes of an authorization.
+func changeKind(e ChangeEvent) handler.AuthorizationChangeKind {
+	switch e.Operation {
+	case "delete":
+		return handler.ChangeRemoved
+	case "insert", "update", "replace":
+	default:
+		return ""
+	}
+
+	if e.FullDocument == nil {
+		// The document was deleted before the event was read, its delete event follows.
+		return ""
+	}
+
+	if enabled, _ := e.FullDocument.Lookup("enabled").BooleanOK(); !enabled {
+		return handler.ChangeDisabled
+	}
+
+	if e.Operation == "insert" {
+		return handler.ChangeAdded
+	}
+
+	kind := handler.ChangeUpdated
+
+	for _, field := range e.UpdatedFields {
+		switch {
+		case field == "enabled":
+			return handler.ChangeAdded
+		case field == "accessToken", field == "bot", strings.HasPrefix(field, "bot."):
+			kind = handler.ChangeTokenRotated
+		}
+	}
+
+	return kind
+}
+
+func (j *AuthorizationJournal) lastToken(ctx context.Context) (bson.Raw, error) {
+	last, err := j.last(ctx)
+	if err != nil || last == nil {
+		return nil, err
+	}
+
+	return last.Token, nil
+}
+
+// currentCursor points after the last recorded change rather than at the current
+// time, so changes still being recorded are not skipped.
+func (j *AuthorizationJournal) currentCursor(ctx context.Context) (*handler.AuthorizationsDelta, error) {
+	last, err := j.last(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &handler.AuthorizationsDelta{
+		Changes: []handler.AuthorizationChange{},
+		Cursor:  encodeCursor(primitive.Timestamp{T: uint32(time.Now().Unix())}, ""),
+	}
+
+	if last != nil {
+		res.Cursor = encodeCursor(last.At, last.ID)
+	}
+
+	return res, nil
+}
+
+// LastModified is the time of the newest change or gap of the journal. Removals are changes too,
+// so it moves whenever the set of authorizations does.
+func (j *AuthorizationJournal) LastModified(ctx context.Context) (time.Time, error) {
+	last, err := j.last(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	gap, err := j.gap(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	at := gap
+	if last != nil && timestampBefore(gap, last.At) {
+		at = last.At
+	}
+	if at.T == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(int64(at.T), 0).UTC(), nil
+}
+
+func (j *AuthorizationJournal) last(ctx context.Context) (*authorizationChange, error) {
+	var last authorizationChange
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}})
+	err := j.db.Collection(authChangesCollectionName).FindOne(ctx, bson.M{}, opts).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &last, nil
+}
+
+func (j *AuthorizationJournal) AuthorizationsSince(ctx context.Context, cursor string, limit int) (*handler.AuthorizationsDelta, error) {
+	if cursor == "" {
+		return j.currentCursor(ctx)
+	}
+
+	at, id, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, handler.ErrInvalidCursor
+	}
+
+	// Changes before a gap are incomplete. The gap is taken from the clock of this process,
+	// a skew expires a few good cursors too, which only costs those clients a full sync.
+	gap, err := j.gap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if timestampBefore(at, gap) {
+		return nil, handler.ErrCursorExpired
+	}
+
+	// Old entries are removed by a TTL index. A cursor is still good while the entry it
+	// points at is kept, as the entries after it are younger.
+	if time.Unix(int64(at.T), 0).Before(time.Now().Add(-j.retention)) {
+		n, err := j.db.Collection(authChangesCollectionName).CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, handler.ErrCursorExpired
+		}
+	}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"at": bson.M{"$gt": at}},
+		bson.M{"at": at, "_id": bson.M{"$gt": id}},
+	}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit) + 1)
+
+	cur, err := j.db.Collection(authChangesCollectionName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []authorizationChange
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	res := &handler.AuthorizationsDelta{
+		Changes: []handler.AuthorizationChange{},
+		Cursor:  cursor,
+	}
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+		res.HasMore = true
+	}
+
+	if len(entries) == 0 {
+		return res, nil
+	}
+
+	auths, err := j.currentAuthorizations(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		res.Changes = append(res.Changes, e.toChange(auths[e.DocumentID]))
+	}
+
+	res.Cursor = res.Changes[len(res.Changes)-1].Cursor
+
+	return res, nil
+}
+
+// currentAuthorizations loads the enabled authorizations changed by entries.
+func (j *AuthorizationJournal) currentAuthorizations(ctx context.Context, entries []authorizationChange) (map[string]*handler.SlackBotAuthorization, error) {
+	ids := bson.A{}
+	for _, e := range entries {
+		ids = append(ids, e.DocumentID)
+	}
+
+	cur, err := j.db.Collection(authsCollectionName).Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "enabled": true})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []slackBotAuthorization
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*handler.SlackBotAuthorization, len(docs))
+	for i := range docs {
+		res[docs[i].ID] = docs[i].toAuthorization()
+	}
+
+	return res, nil
+}
+
+func timestampBefore(a primitive.Timestamp, b primitive.Timestamp) bool {
+	return a.T < b.T || a.T == b.T && a.I < b.I
+}
+
+// tokenID makes a string key of a resume token. Tokens of Mongo 3.6+ keep it in _data.
+func tokenID(token bson.Raw) string {
+	if data, ok := token.Lookup("_data").StringValueOK(); ok {
+		return data
+	}
+
+	return hex.EncodeToString(token)
+}
+
+// Cursors are opaque to clients: the cluster time and the ID of the last change they have seen.
+func encodeCursor(at primitive.Timestamp, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d.%s", at.T, at.I, id)))
+}
+
+func decodeCursor(cursor string) (primitive.Timestamp, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return primitive.Timestamp{}, "", err
+	}
+
+	parts := strings.SplitN(string(b), ".", 3)
+	if len(parts) != 3 {
+		return primitive.Timestamp{}, "", fmt.Errorf("malformed cursor")
+	}
+
+	t, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return primitive.Timestamp{}, "", err
+	}
+
+	i, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return primitive.Timestamp{}, "", err
+	}
+
+	return primitive.Timestamp{T: uint32(t), I: uint32(i)}, parts[2], nil
+}
@@ -1,6 +1,10 @@
 package mongodb
 
-import "time"
+import (
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+)
 
 type slackBotAuthorization struct {
 	ID          string    `bson:"_id"`
@@ -10,6 +14,7 @@ type slackBotAuthorization struct {
 	TeamName    string    `bson:"teamName"`
 	TeamId      string    `bson:"teamId"`
 	CreatedAt   time.Time `bson:"createdAt"`
+	UpdatedAt   time.Time `bson:"updatedAt,omitempty"`
 	Enabled     bool      `bson:"enabled"`
 
 	Bot struct {
@@ -17,3 +22,26 @@ type slackBotAuthorization struct {
 		BotAccessToken string `bson:"botAccessToken"`
 	} `bson:"bot"`
 }
+
+func (doc *slackBotAuthorization) toAuthorization() *handler.SlackBotAuthorization {
+	var updatedAt string
+	if !doc.UpdatedAt.IsZero() {
+		updatedAt = doc.UpdatedAt.Format(time.RFC3339)
+	}
+
+	return &handler.SlackBotAuthorization{
+		ID:          doc.ID,
+		AccessToken: doc.AccessToken,
+		Scope:       doc.Scope,
+		UserId:      doc.UserId,
+		TeamName:    doc.TeamName,
+		TeamId:      doc.TeamId,
+		CreatedAt:   doc.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   updatedAt,
+		Enabled:     doc.Enabled,
+		Bot: handler.BotInfo{
+			BotUserId:      doc.Bot.BotUserId,
+			BotAccessToken: doc.Bot.BotAccessToken,
+		},
+	}
+}
@@ -2,14 +2,12 @@ package mongodb
 
 import (
 	"context"
-	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 
 	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -19,50 +17,63 @@ const (
 )
 
 type slackBotAuthorizationsRepository struct {
-	client *mongo.Client
-	db     *mongo.Database
+	client   *mongo.Client
+	db       *mongo.Database
+	resolver *handler.DuplicatesResolver
 }
 
-func NewSlackBotAuthorizationsRepository(uri string) handler.AuthorizationsRepository {
-	clientOptions := options.Client()
-	clientOptions.SetConnectTimeout(time.Duration(60) * time.Second)
-	clientOptions.ApplyURI(uri)
+// NewSlackBotAuthorizationsRepository connects to Mongo. The resolver is used to pick
+// a single authorization when a team has several enabled ones.
+func NewSlackBotAuthorizationsRepository(uri string, resolver *handler.DuplicatesResolver) handler.AuthorizationsRepository {
+	client, db := connect(uri, "NewSlackBotAuthorizationsRepository")
 
-	client, err := mongo.NewClient(clientOptions)
-
-	if err != nil {
-		log.WithError(err).Fatal()
+	return &slackBotAuthorizationsRepository{
+		client,
+		db,
+		resolver,
 	}
+}
 
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	err = client.Connect(ctx)
-	if err != nil {
-		log.WithError(err).Fatal()
+func (r *slackBotAuthorizationsRepository) collectionIndexes() []collectionIndexes {
+	return []collectionIndexes{
+		{
+			Collection: r.db.Collection(authsCollectionName),
+			Indexes: []index{
+				{Name: "enabled_1_teamId_1", Keys: bson.D{{Key: "enabled", Value: 1}, {Key: "teamId", Value: 1}}},
+				// Installs upsert the authorization of a team and user, uninstalls disable those of a team.
+				{Name: "teamId_1_userId_1", Keys: bson.D{{Key: "teamId", Value: 1}, {Key: "userId", Value: 1}}},
+			},
+			HotQueries: []hotQuery{
+				{Name: "GetAllAuthorizations", Filter: bson.D{{Key: "enabled", Value: true}}},
+				{Name: "GetAuthorization", Filter: bson.D{{Key: "enabled", Value: true}, {Key: "teamId", Value: "T0"}}},
+				{Name: "GetAuthorizations", Filter: bson.D{{Key: "enabled", Value: true}, {Key: "teamId", Value: bson.M{"$in": []string{"T0", "T1"}}}}},
+				{Name: "SaveInstallation", Filter: bson.D{{Key: "teamId", Value: "T0"}, {Key: "userId", Value: "U0"}}},
+				{Name: "DisableTeam", Filter: bson.D{{Key: "teamId", Value: "T0"}, {Key: "enabled", Value: true}}},
+			},
+		},
 	}
+}
 
-	connstr, err := connstring.Parse(uri)
+func (r *slackBotAuthorizationsRepository) GetAllAuthorizations(ctx context.Context) ([]*handler.SlackBotAuthorization, error) {
+	filter := bson.M{"enabled": true}
 
+	docs, err := r.findMany(ctx, filter)
 	if err != nil {
-		log.WithError(err).Fatal()
+		log.WithContext(ctx).WithError(err).Debug()
+		return nil, err
 	}
 
-	// Check the connection
-	err = client.Ping(context.Background(), nil)
+	res := make([]*handler.SlackBotAuthorization, len(docs))
 
-	if err != nil {
-		log.WithError(err).Error("NewSlackBotAuthorizationsRepository client.Ping")
+	for i, doc := range docs {
+		res[i] = doc.toAuthorization()
 	}
 
-	db := client.Database(connstr.Database)
-
-	return &slackBotAuthorizationsRepository{
-		client,
-		db,
-	}
+	return res, nil
 }
 
-func (r *slackBotAuthorizationsRepository) GetAllAuthorizations(ctx context.Context) ([]*handler.SlackBotAuthorization, error) {
-	filter := bson.D{{"enabled", true}}
+func (r *slackBotAuthorizationsRepository) GetAuthorization(ctx context.Context, teamId string) (*handler.SlackBotAuthorization, error) {
+	filter := bson.M{"enabled": true, "teamId": teamId}
 
 	docs, err := r.findMany(ctx, filter)
 	if err != nil {
@@ -70,54 +81,51 @@ func (r *slackBotAuthorizationsRepository) GetAllAuthorizations(ctx context.Cont
 		return nil, err
 	}
 
-	res := make([]*handler.SlackBotAuthorization, len(docs))
+	if len(docs) == 0 {
+		return nil, handler.ErrNotFound
+	}
 
+	auths := make([]*handler.SlackBotAuthorization, len(docs))
 	for i, doc := range docs {
-		res[i] = &handler.SlackBotAuthorization{
-			AccessToken: doc.AccessToken,
-			Scope:       doc.Scope,
-			UserId:      doc.UserId,
-			TeamName:    doc.TeamName,
-			TeamId:      doc.TeamId,
-			CreatedAt:   doc.CreatedAt.Format(time.RFC3339),
-			Enabled:     doc.Enabled,
-			Bot: handler.BotInfo{
-				BotUserId:      doc.Bot.BotUserId,
-				BotAccessToken: doc.Bot.BotAccessToken,
-			},
-		}
+		auths[i] = doc.toAuthorization()
 	}
 
-	return res, nil
+	return r.resolver.Winner(auths), nil
 }
 
-func (r *slackBotAuthorizationsRepository) GetAuthorization(ctx context.Context, teamId string) (*handler.SlackBotAuthorization, error) {
-	filter := bson.D{{"enabled", true}, {"teamId", teamId}}
+// GetAuthorizations finds the enabled authorizations of all teamIDs with a single query.
+func (r *slackBotAuthorizationsRepository) GetAuthorizations(ctx context.Context, teamIDs []string) (*handler.AuthorizationsBatch, error) {
+	res := &handler.AuthorizationsBatch{}
+	if len(teamIDs) == 0 {
+		return res, nil
+	}
+
+	filter := bson.M{"enabled": true, "teamId": bson.M{"$in": teamIDs}}
 
-	doc, err := r.findOne(ctx, filter)
+	docs, err := r.findMany(ctx, filter)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, handler.ErrNotFound
-		}
-		
 		log.WithContext(ctx).WithError(err).Debug()
 		return nil, err
 	}
 
-	res := &handler.SlackBotAuthorization{
-		AccessToken: doc.AccessToken,
-		Scope:       doc.Scope,
-		UserId:      doc.UserId,
-		TeamName:    doc.TeamName,
-		TeamId:      doc.TeamId,
-		CreatedAt:   doc.CreatedAt.Format(time.RFC3339),
-		Enabled:     doc.Enabled,
-		Bot: handler.BotInfo{
-			BotUserId:      doc.Bot.BotUserId,
-			BotAccessToken: doc.Bot.BotAccessToken,
-		},
+	byTeam := make(map[string][]*handler.SlackBotAuthorization)
+	for _, doc := range docs {
+		byTeam[doc.TeamId] = append(byTeam[doc.TeamId], doc.toAuthorization())
+	}
+
+	seen := make(map[string]bool, len(teamIDs))
+	for _, teamID := range teamIDs {
+		if seen[teamID] {
+			continue
+		}
+		seen[teamID] = true
+
+		if auths := byTeam[teamID]; len(auths) > 0 {
+			res.Authorizations = append(res.Authorizations, r.resolver.Winner(auths))
+		} else {
+			res.Missing = append(res.Missing, teamID)
+		}
 	}
-	
 
 	return res, nil
 }
@@ -127,26 +135,18 @@ func (r *slackBotAuthorizationsRepository) findMany(ctx context.Context, filter
 
 	collection := r.db.Collection(authsCollectionName)
 
-	findOptions := options.Find()
-
-	projection := bson.D{
-		{"scope", 0},
+	cur, err := collection.Find(ctx, filter, options.Find().SetProjection(authorizationProjection(handler.AuthorizationFieldsFromContext(ctx))))
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Debug()
+		return nil, err
 	}
 
-	findOptions.SetProjection(projection)
-
-	cur, err := collection.Find(ctx, filter, findOptions)
 	defer func() {
 		if err := cur.Close(ctx); err != nil {
 			log.WithError(err).Error("Failed to close cursor in findMany")
 		}
 	}()
 
-	if err != nil {
-		log.WithContext(ctx).WithError(err).Debug()
-		return nil, err
-	}
-
 	err = cur.All(ctx, &docs)
 	if err != nil {
 		log.WithContext(ctx).WithError(err).Debug()
@@ -154,31 +154,43 @@ func (r *slackBotAuthorizationsRepository) findMany(ctx context.Context, filter
 	}
 
 	log.WithContext(ctx).Debugf("findMany: %d\n", len(docs))
-	log.WithContext(ctx).Debugf("findMany: %+v\n", docs[0])
 
 	return docs, nil
 }
 
-func (r *slackBotAuthorizationsRepository) findOne(ctx context.Context, filter interface{}) (*slackBotAuthorization, error) {
-	var doc *slackBotAuthorization
-
-	collection := r.db.Collection(authsCollectionName)
+// resolverFields are read by handler.DuplicatesResolver, they are loaded whatever fields the caller selected.
+var resolverFields = []string{
+	handler.FieldID,
+	handler.FieldTeamID,
+	handler.FieldScope,
+	handler.FieldCreatedAt,
+	handler.FieldUpdatedAt,
+	handler.FieldBotAccessToken,
+}
 
-	findOptions := options.FindOne()
+// authorizationProjection loads the selected fields only, nil loads whole documents.
+func authorizationProjection(f handler.AuthorizationFields) interface{} {
+	if f == nil {
+		return nil
+	}
 
-	projection := bson.D{
-		{"scope", 0},
+	projection := bson.M{}
+	for _, field := range handler.AuthorizationFieldNames {
+		if f.Has(field) {
+			projection[authorizationKey(field)] = 1
+		}
+	}
+	for _, field := range resolverFields {
+		projection[authorizationKey(field)] = 1
 	}
 
-	findOptions.SetProjection(projection)
+	return projection
+}
 
-	err := collection.FindOne(ctx, filter, findOptions).Decode(&doc)
-	if err != nil {
-		log.WithContext(ctx).WithError(err).Debug()
-		return nil, err
+func authorizationKey(field string) string {
+	if field == handler.FieldID {
+		return "_id"
 	}
 
-	log.WithContext(ctx).Debugf("findOne: %+v\n", doc)
-
-	return doc, nil
+	return field
 }
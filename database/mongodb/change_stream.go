@@ -0,0 +1,148 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ChangeEvent is a single change of a watched collection.
+type ChangeEvent struct {
+	// Operation is the Mongo operation type: insert, update, replace or delete.
+	Operation  string
+	DocumentID string
+	// TeamID is the Slack team ID of the changed document.
+	// It is empty for deletes, as the document is gone by the time the event is read.
+	TeamID        string
+	UpdatedFields []string
+	ClusterTime   primitive.Timestamp
+	ResumeToken   bson.Raw
+	FullDocument  bson.Raw
+}
+
+type changeStreamEvent struct {
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription struct {
+		UpdatedFields bson.Raw `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+	FullDocument bson.Raw `bson:"fullDocument"`
+}
+
+// ChangeStreams subscribes to changes of the service collections. It needs Mongo running as a replica set.
+type ChangeStreams struct {
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+func NewChangeStreams(uri string) *ChangeStreams {
+	client, db := connect(uri, "NewChangeStreams")
+
+	return &ChangeStreams{
+		client,
+		db,
+	}
+}
+
+// WatchAuthorizations calls fn for every change of slack-bot-authorizations until ctx is done.
+func (s *ChangeStreams) WatchAuthorizations(ctx context.Context, fn func(ChangeEvent)) {
+	s.watch(ctx, authsCollectionName, "teamId", nil, nil, fn)
+}
+
+// WatchAuthorizationsFrom is WatchAuthorizations that starts after the event of resumeAfter.
+// If that event is no longer in the oplog, lost is called before it starts from the current moment,
+// as changes in between will never be seen.
+func (s *ChangeStreams) WatchAuthorizationsFrom(ctx context.Context, resumeAfter bson.Raw, lost func(), fn func(ChangeEvent)) {
+	s.watch(ctx, authsCollectionName, "teamId", resumeAfter, lost, fn)
+}
+
+// WatchTeams calls fn for every change of slack-teams until ctx is done.
+func (s *ChangeStreams) WatchTeams(ctx context.Context, fn func(ChangeEvent)) {
+	s.watch(ctx, slackTeamsCollectionName, "id", nil, nil, fn)
+}
+
+// watch keeps a change stream open, reopening it after errors from the last seen resume token.
+// lost, if not nil, is called when the stream cannot resume and changes were missed.
+func (s *ChangeStreams) watch(ctx context.Context, collection string, teamIDField string, resumeAfter bson.Raw, lost func(), fn func(ChangeEvent)) {
+	logger := log.WithField("collection", collection)
+
+	for ctx.Err() == nil {
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+		if resumeAfter != nil {
+			opts.SetResumeAfter(resumeAfter)
+		}
+
+		stream, err := s.db.Collection(collection).Watch(ctx, mongo.Pipeline{}, opts)
+		if err != nil && resumeAfter != nil && isHistoryLost(err) {
+			logger.WithError(err).Error("Change stream cannot resume, changes since the resume token are lost")
+			if lost != nil {
+				lost()
+			}
+			resumeAfter = nil
+			continue
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to open change stream")
+			sleepContext(ctx, 5*time.Second)
+			continue
+		}
+
+		for stream.Next(ctx) {
+			var e changeStreamEvent
+			if err := stream.Decode(&e); err != nil {
+				logger.WithError(err).Error("Failed to decode change event")
+				continue
+			}
+
+			event := ChangeEvent{
+				Operation:    e.OperationType,
+				DocumentID:   e.DocumentKey.ID,
+				ClusterTime:  e.ClusterTime,
+				ResumeToken:  stream.ResumeToken(),
+				FullDocument: e.FullDocument,
+			}
+
+			if e.FullDocument != nil {
+				event.TeamID, _ = e.FullDocument.Lookup(teamIDField).StringValueOK()
+			}
+
+			if elems, err := e.UpdateDescription.UpdatedFields.Elements(); err == nil {
+				for _, el := range elems {
+					event.UpdatedFields = append(event.UpdatedFields, el.Key())
+				}
+			}
+
+			resumeAfter = event.ResumeToken
+			fn(event)
+		}
+
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			logger.WithError(err).Error("Change stream failed, reopening")
+			sleepContext(ctx, time.Second)
+		}
+
+		stream.Close(context.Background())
+	}
+}
+
+// isHistoryLost reports whether a change stream cannot resume because the oplog no longer has the resume point.
+func isHistoryLost(err error) bool {
+	e, ok := err.(mongo.CommandError)
+	return ok && (e.Code == 286 || e.Code == 280 || e.HasErrorLabel("NonResumableChangeStreamError"))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
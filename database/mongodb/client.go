@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// connect creates a client for uri and returns it along with the database named in uri.
+// It is fatal for the process if the URI is invalid or the client cannot be created;
+// a failed ping is only logged so the service can start while Mongo is unavailable.
+func connect(uri string, name string) (*mongo.Client, *mongo.Database) {
+	clientOptions := options.Client()
+	clientOptions.SetConnectTimeout(time.Duration(60) * time.Second)
+	clientOptions.ApplyURI(uri)
+
+	client, err := mongo.NewClient(clientOptions)
+
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = client.Connect(ctx)
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	connstr, err := connstring.Parse(uri)
+
+	if err != nil {
+		log.WithError(err).Fatal()
+	}
+
+	// Check the connection
+	err = client.Ping(context.Background(), nil)
+
+	if err != nil {
+		log.WithError(err).Error(name + " client.Ping")
+	}
+
+	return client, client.Database(connstr.Database)
+}
+
+// isDuplicateKeyError reports whether err was caused by a unique index violation.
+func isDuplicateKeyError(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == 11000 {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == 11000
+	}
+
+	return false
+}
+
+// Ping checks that the primary of every mongodb repository of repos answers,
+// a repository that cannot reach it cannot write. Values that are not mongodb repositories are ignored.
+func Ping(ctx context.Context, repos ...interface{}) error {
+	pinged := map[*mongo.Client]bool{}
+
+	for _, repo := range repos {
+		ir, ok := repo.(indexedRepository)
+		if !ok {
+			continue
+		}
+
+		for _, ci := range ir.collectionIndexes() {
+			client := ci.Collection.Database().Client()
+			if pinged[client] {
+				continue
+			}
+			pinged[client] = true
+
+			if err := client.Ping(ctx, readpref.Primary()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
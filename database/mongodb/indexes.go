@@ -0,0 +1,280 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errIndexConflict marks reconciliation errors of the declared indexes themselves,
+// as opposed to Mongo being unreachable.
+var errIndexConflict = errors.New("index conflict")
+
+// IsIndexConflict reports whether err of ReconcileIndexes is an index that cannot be created
+// or a hot query that scans its collection. Other errors are of reaching Mongo.
+func IsIndexConflict(err error) bool {
+	return errors.Is(err, errIndexConflict)
+}
+
+// index is an index a repository relies on.
+type index struct {
+	Name      string
+	Keys      bson.D
+	Unique    bool
+	Collation *options.Collation
+	// ExpireAfter makes a TTL index removing documents this many seconds after the indexed time.
+	ExpireAfter *int32
+}
+
+// hotQuery is a query a repository runs often enough that it must be served by an index.
+type hotQuery struct {
+	Name      string
+	Filter    bson.D
+	Collation *options.Collation
+}
+
+// collectionIndexes is what a repository declares about one of its collections.
+type collectionIndexes struct {
+	Collection *mongo.Collection
+	Indexes    []index
+	HotQueries []hotQuery
+}
+
+// indexedRepository is implemented by repositories that declare their indexes.
+type indexedRepository interface {
+	collectionIndexes() []collectionIndexes
+}
+
+type existingIndex struct {
+	Name        string `bson:"name"`
+	Keys        bson.D `bson:"key"`
+	Unique      bool   `bson:"unique"`
+	ExpireAfter *int32 `bson:"expireAfterSeconds"`
+	Collation   *struct {
+		Locale   string `bson:"locale"`
+		Strength int    `bson:"strength"`
+	} `bson:"collation"`
+}
+
+// ReconcileIndexes creates indexes declared by repos that are missing, logs
+// drift between declared and existing ones and then verifies that hot queries
+// do not scan whole collections. Values that are not mongodb repositories are ignored.
+// Index drift is never fixed automatically, dropping indexes is left to a human.
+func ReconcileIndexes(ctx context.Context, repos ...interface{}) error {
+	for _, repo := range repos {
+		ir, ok := repo.(indexedRepository)
+		if !ok {
+			continue
+		}
+
+		for _, ci := range ir.collectionIndexes() {
+			if err := reconcileCollectionIndexes(ctx, ci); err != nil {
+				return err
+			}
+
+			if err := verifyHotQueries(ctx, ci); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func reconcileCollectionIndexes(ctx context.Context, ci collectionIndexes) error {
+	name := ci.Collection.Name()
+	logger := log.WithContext(ctx).WithField("collection", name)
+
+	existing, err := listIndexes(ctx, ci.Collection)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes of %s: %w", name, err)
+	}
+
+	declared := map[string]bool{}
+
+	for _, idx := range ci.Indexes {
+		declared[idx.Name] = true
+
+		found := findIndex(existing, idx)
+		if found == nil {
+			opts := options.Index().SetName(idx.Name)
+			if idx.Unique {
+				opts.SetUnique(true)
+			}
+			if idx.Collation != nil {
+				opts.SetCollation(idx.Collation)
+			}
+			if idx.ExpireAfter != nil {
+				opts.SetExpireAfterSeconds(*idx.ExpireAfter)
+			}
+
+			if _, err := ci.Collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: idx.Keys, Options: opts}); err != nil {
+				if ce, ok := err.(mongo.CommandError); ok && !ce.HasErrorLabel("NetworkError") {
+					return fmt.Errorf("failed to create index %s on %s: %v: %w", idx.Name, name, err, errIndexConflict)
+				}
+
+				return fmt.Errorf("failed to create index %s on %s: %w", idx.Name, name, err)
+			}
+
+			logger.Infof("Created index %s", idx.Name)
+			continue
+		}
+
+		if found.Name != idx.Name {
+			declared[found.Name] = true
+			logger.Warnf("Index drift: %s exists as %s", idx.Name, found.Name)
+		}
+
+		if !sameKeys(found.Keys, idx.Keys) || found.Unique != idx.Unique {
+			logger.Warnf("Index drift: %s has keys %s unique=%t, declared %s unique=%t",
+				idx.Name, formatKeys(found.Keys), found.Unique, formatKeys(idx.Keys), idx.Unique)
+		}
+
+		if !sameCollation(found, idx) {
+			logger.Warnf("Index drift: %s has a different collation than declared", idx.Name)
+		}
+
+		if !sameExpiry(found, idx) {
+			logger.Warnf("Index drift: %s has a different TTL than declared", idx.Name)
+		}
+	}
+
+	for _, e := range existing {
+		if e.Name != "_id_" && !declared[e.Name] {
+			logger.Warnf("Index drift: %s %s is not declared by the service", e.Name, formatKeys(e.Keys))
+		}
+	}
+
+	return nil
+}
+
+// verifyHotQueries explains every hot query and fails if the winning plan scans the collection.
+func verifyHotQueries(ctx context.Context, ci collectionIndexes) error {
+	name := ci.Collection.Name()
+
+	for _, q := range ci.HotQueries {
+		find := bson.D{
+			{Key: "find", Value: name},
+			{Key: "filter", Value: q.Filter},
+		}
+		if q.Collation != nil {
+			find = append(find, bson.E{Key: "collation", Value: q.Collation.ToDocument()})
+		}
+
+		cmd := bson.D{
+			{Key: "explain", Value: find},
+			{Key: "verbosity", Value: "queryPlanner"},
+		}
+
+		res, err := ci.Collection.Database().RunCommand(ctx, cmd).DecodeBytes()
+		if err != nil {
+			return fmt.Errorf("failed to explain %s on %s: %w", q.Name, name, err)
+		}
+
+		var plan bson.M
+		if err := res.Lookup("queryPlanner", "winningPlan").Unmarshal(&plan); err != nil {
+			return fmt.Errorf("failed to read plan of %s on %s: %w", q.Name, name, err)
+		}
+
+		if hasStage(plan, "COLLSCAN") {
+			return fmt.Errorf("hot query %s on %s does a collection scan: %w", q.Name, name, errIndexConflict)
+		}
+	}
+
+	return nil
+}
+
+func listIndexes(ctx context.Context, collection *mongo.Collection) ([]existingIndex, error) {
+	cur, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []existingIndex
+	if err := cur.All(ctx, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// findIndex looks an index up by name first and then by keys, as Mongo refuses
+// to create an index with the same keys under another name.
+func findIndex(existing []existingIndex, idx index) *existingIndex {
+	for i := range existing {
+		if existing[i].Name == idx.Name {
+			return &existing[i]
+		}
+	}
+
+	for i := range existing {
+		if sameKeys(existing[i].Keys, idx.Keys) {
+			return &existing[i]
+		}
+	}
+
+	return nil
+}
+
+// sameKeys compares key patterns ignoring numeric types, Mongo may return 1 as int32 or double.
+func sameKeys(a, b bson.D) bool {
+	return formatKeys(a) == formatKeys(b)
+}
+
+func sameCollation(found *existingIndex, idx index) bool {
+	if found.Collation == nil || idx.Collation == nil {
+		return found.Collation == nil && idx.Collation == nil
+	}
+
+	return found.Collation.Locale == idx.Collation.Locale && found.Collation.Strength == idx.Collation.Strength
+}
+
+func sameExpiry(found *existingIndex, idx index) bool {
+	if found.ExpireAfter == nil || idx.ExpireAfter == nil {
+		return found.ExpireAfter == nil && idx.ExpireAfter == nil
+	}
+
+	return *found.ExpireAfter == *idx.ExpireAfter
+}
+
+func formatKeys(keys bson.D) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s:%v", k.Key, k.Value)
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// hasStage walks an explain plan looking for the stage.
+func hasStage(plan interface{}, stage string) bool {
+	switch p := plan.(type) {
+	case bson.M:
+		if s, ok := p["stage"].(string); ok && s == stage {
+			return true
+		}
+
+		for _, v := range p {
+			if hasStage(v, stage) {
+				return true
+			}
+		}
+	case bson.D:
+		return hasStage(p.Map(), stage)
+	case bson.A:
+		for _, v := range p {
+			if hasStage(v, stage) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
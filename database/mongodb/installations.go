@@ -0,0 +1,170 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/slack"
+)
+
+// meteorIDChars and meteorIDLength make IDs like the ones Meteor gives documents it inserts.
+const (
+	meteorIDChars  = "23456789ABCDEFGHJKLMNPQRSTWXYZabcdefghijkmnopqrstuvwxyz"
+	meteorIDLength = 17
+)
+
+// installationsRepository stores installs and uninstalls into the collections Meteor owns.
+// The indexes of its updates are declared by the repositories of those collections.
+type installationsRepository struct {
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+func NewInstallationsRepository(uri string) slack.Repository {
+	client, db := connect(uri, "NewInstallationsRepository")
+
+	return &installationsRepository{
+		client,
+		db,
+	}
+}
+
+// SaveInstallation upserts the authorization of the team and user, enabling it, then the team.
+// The team is restored if it was deleted.
+func (r *installationsRepository) SaveInstallation(ctx context.Context, inst slack.Installation) (string, bool, error) {
+	now := time.Now().UTC()
+	a := inst.Authorization
+
+	id, err := newMeteorID()
+	if err != nil {
+		return "", false, err
+	}
+
+	var doc struct {
+		ID string `bson:"_id"`
+	}
+
+	err = r.db.Collection(authsCollectionName).FindOneAndUpdate(ctx,
+		bson.M{"teamId": a.TeamId, "userId": a.UserId},
+		bson.M{
+			"$set": bson.M{
+				"accessToken":        a.AccessToken,
+				"scope":              a.Scope,
+				"teamName":           a.TeamName,
+				"enabled":            true,
+				"updatedAt":          now,
+				"bot.botUserId":      a.Bot.BotUserId,
+				"bot.botAccessToken": a.Bot.BotAccessToken,
+			},
+			"$setOnInsert": bson.M{"_id": id, "createdAt": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After).SetProjection(bson.M{"_id": 1}),
+	).Decode(&doc)
+	if err != nil {
+		return "", false, err
+	}
+
+	if inst.Team != nil {
+		if err := r.saveTeam(ctx, inst, now); err != nil {
+			return doc.ID, doc.ID == id, err
+		}
+	}
+
+	return doc.ID, doc.ID == id, nil
+}
+
+func (r *installationsRepository) saveTeam(ctx context.Context, inst slack.Installation, now time.Time) error {
+	t := inst.Team
+
+	set := bson.M{
+		"name":      t.Name,
+		"isDeleted": false,
+		"deletedAt": nil,
+	}
+	// Unknown details are left as they are, team.info needs a scope the bot may lack.
+	if t.Domain != "" {
+		set["domain"] = t.Domain
+	}
+	if t.EmailDomain != "" {
+		set["emailDomain"] = t.EmailDomain
+	}
+	if t.Icon.Image34 != "" {
+		set["icon"] = SlackIcon{
+			Image34:      t.Icon.Image34,
+			Image44:      t.Icon.Image44,
+			Image68:      t.Icon.Image68,
+			Image88:      t.Icon.Image88,
+			Image102:     t.Icon.Image102,
+			Image132:     t.Icon.Image132,
+			Image230:     t.Icon.Image230,
+			ImageDefault: t.Icon.ImageDefault,
+		}
+	}
+
+	id, err := newMeteorID()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(slackTeamsCollectionName).UpdateOne(ctx,
+		bson.M{"id": t.ID},
+		bson.M{
+			"$set":         set,
+			"$setOnInsert": bson.M{"_id": id, "createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+
+	return err
+}
+
+func (r *installationsRepository) DisableTeam(ctx context.Context, teamID string) (int64, error) {
+	return r.disable(ctx, bson.M{"teamId": teamID, "enabled": true})
+}
+
+func (r *installationsRepository) DisableTokens(ctx context.Context, teamID string, userIDs []string, botUserIDs []string) (int64, error) {
+	var or bson.A
+	if len(userIDs) > 0 {
+		or = append(or, bson.M{"userId": bson.M{"$in": userIDs}})
+	}
+	if len(botUserIDs) > 0 {
+		or = append(or, bson.M{"bot.botUserId": bson.M{"$in": botUserIDs}})
+	}
+	if len(or) == 0 {
+		return 0, nil
+	}
+
+	return r.disable(ctx, bson.M{"teamId": teamID, "enabled": true, "$or": or})
+}
+
+func (r *installationsRepository) disable(ctx context.Context, filter bson.M) (int64, error) {
+	res, err := r.db.Collection(authsCollectionName).UpdateMany(ctx, filter, bson.M{
+		"$set": bson.M{"enabled": false, "updatedAt": time.Now().UTC()},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return res.ModifiedCount, nil
+}
+
+func newMeteorID() (string, error) {
+	b := make([]byte, meteorIDLength)
+	max := big.NewInt(int64(len(meteorIDChars)))
+
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = meteorIDChars[n.Int64()]
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,82 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// migrations is the ordered list of data migrations. Never change or reorder
+// applied migrations, add a new version instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "slack-teams: move tags from `enabled` to `tags`",
+		Up:      migrateTeamTags,
+	},
+	{
+		Version: 2,
+		Name:    "slack-teams: backfill `id` from `_id`",
+		Up:      migrateTeamIDs,
+	},
+}
+
+// migrateTeamTags renames the tags array that was stored under `enabled`.
+// Documents where `enabled` is not an array are left untouched.
+func migrateTeamTags(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error) {
+	collection := db.Collection(slackTeamsCollectionName)
+	filter := bson.M{"enabled": bson.M{"$type": "array"}}
+
+	if dryRun {
+		return collection.CountDocuments(ctx, filter)
+	}
+
+	res, err := collection.UpdateMany(ctx, filter, bson.M{"$rename": bson.M{"enabled": "tags"}})
+	if err != nil {
+		return 0, err
+	}
+
+	return res.ModifiedCount, nil
+}
+
+// migrateTeamIDs sets `id` on documents that only have it in `_id`.
+// Only `_id` values shaped like a Slack team ID are copied, random Meteor IDs are skipped.
+func migrateTeamIDs(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error) {
+	collection := db.Collection(slackTeamsCollectionName)
+	filter := bson.M{
+		"id":  bson.M{"$exists": false},
+		"_id": bson.M{"$regex": "^[TE][A-Z0-9]+$"},
+	}
+
+	if dryRun {
+		return collection.CountDocuments(ctx, filter)
+	}
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var affected int64
+
+	for cur.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+
+		if err := cur.Decode(&doc); err != nil {
+			return affected, err
+		}
+
+		res, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"id": doc.ID}})
+		if err != nil {
+			return affected, err
+		}
+
+		affected += res.ModifiedCount
+	}
+
+	return affected, cur.Err()
+}
@@ -0,0 +1,300 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/shared"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	migrationsCollectionName     = "migrations"
+	migrationsLockCollectionName = "migrations-lock"
+
+	migrationsLockID = "migrations"
+)
+
+var (
+	ErrMigrationsLocked   = errors.New("migrations are locked by another process")
+	ErrMigrationsLockLost = errors.New("migrations lock was lost")
+)
+
+// Migration is a single versioned change of the data.
+type Migration struct {
+	Version int
+	Name    string
+	// Up applies the migration and returns the number of affected documents.
+	// When dryRun is set it must not modify anything and only count the documents it would change.
+	Up func(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error)
+}
+
+// MigrationStatus describes a known migration and whether it has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	Affected  int64
+}
+
+type migrationRecord struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+	Affected  int64     `bson:"affected"`
+}
+
+// Migrator applies migrations in version order and records them in the migrations collection.
+// Only one process can apply migrations at a time; the lock expires after lockTTL
+// so a crashed process does not block others forever. It is renewed while migrations run.
+type Migrator struct {
+	client     *mongo.Client
+	db         *mongo.Database
+	migrations []Migration
+	owner      string
+	lockTTL    time.Duration
+}
+
+func NewMigrator(uri string) *Migrator {
+	client, db := connect(uri, "NewMigrator")
+
+	hostname, _ := os.Hostname()
+
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{
+		client:     client,
+		db:         db,
+		migrations: sorted,
+		owner:      hostname + "/" + shared.RandStringBytesMaskImprSrcUnsafe(8),
+		lockTTL:    10 * time.Minute,
+	}
+}
+
+// Status returns all known migrations in version order.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]MigrationStatus, len(m.migrations))
+
+	for i, mg := range m.migrations {
+		res[i] = MigrationStatus{
+			Version: mg.Version,
+			Name:    mg.Name,
+		}
+
+		if rec, ok := applied[mg.Version]; ok {
+			appliedAt := rec.AppliedAt
+			res[i].AppliedAt = &appliedAt
+			res[i].Affected = rec.Affected
+		}
+	}
+
+	return res, nil
+}
+
+// Pending returns migrations that have not been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Migration
+
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; !ok {
+			res = append(res, mg)
+		}
+	}
+
+	return res, nil
+}
+
+// Apply runs all pending migrations. With dryRun nothing is changed or recorded,
+// the returned statuses only carry the number of documents each migration would touch.
+func (m *Migrator) Apply(ctx context.Context, dryRun bool) ([]MigrationStatus, error) {
+	if !dryRun {
+		if err := m.lock(ctx); err != nil {
+			return nil, err
+		}
+
+		defer m.unlock()
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		go m.keepLocked(ctx, cancel)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]MigrationStatus, 0, len(pending))
+
+	for _, mg := range pending {
+		logger := log.WithContext(ctx).WithField("migration", mg.Version).WithField("dryRun", dryRun)
+		logger.Infof("Applying migration %d: %s", mg.Version, mg.Name)
+
+		affected, err := mg.Up(ctx, m.db, dryRun)
+		if err != nil {
+			return res, fmt.Errorf("migration %d (%s) failed: %w", mg.Version, mg.Name, err)
+		}
+
+		status := MigrationStatus{
+			Version:  mg.Version,
+			Name:     mg.Name,
+			Affected: affected,
+		}
+
+		if !dryRun {
+			rec := migrationRecord{
+				Version:   mg.Version,
+				Name:      mg.Name,
+				AppliedAt: time.Now().UTC(),
+				Affected:  affected,
+			}
+
+			if _, err := m.db.Collection(migrationsCollectionName).InsertOne(ctx, rec); err != nil {
+				return res, fmt.Errorf("failed to record migration %d: %w", mg.Version, err)
+			}
+
+			status.AppliedAt = &rec.AppliedAt
+		}
+
+		logger.Infof("Migration %d affected %d documents", mg.Version, affected)
+		res = append(res, status)
+	}
+
+	return res, nil
+}
+
+func (m *Migrator) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]migrationRecord, error) {
+	cur, err := m.db.Collection(migrationsCollectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var recs []migrationRecord
+	if err := cur.All(ctx, &recs); err != nil {
+		return nil, err
+	}
+
+	res := make(map[int]migrationRecord, len(recs))
+	for _, rec := range recs {
+		res[rec.Version] = rec
+	}
+
+	return res, nil
+}
+
+// lock takes the lock document if it is missing or expired. A live lock held
+// by someone else makes the upsert collide on _id.
+func (m *Migrator) lock(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	filter := bson.M{
+		"_id": migrationsLockID,
+		"$or": bson.A{
+			bson.M{"expiresAt": bson.M{"$lt": now}},
+			bson.M{"owner": m.owner},
+		},
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"owner":     m.owner,
+			"lockedAt":  now,
+			"expiresAt": now.Add(m.lockTTL),
+		},
+	}
+
+	_, err := m.db.Collection(migrationsLockCollectionName).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if isDuplicateKeyError(err) {
+		return ErrMigrationsLocked
+	}
+
+	return err
+}
+
+// keepLocked renews the lock until ctx is done. Migrations are cancelled when the lock was taken
+// over or could not be renewed for long enough that it may expire, another process may take it then.
+func (m *Migrator) keepLocked(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(m.lockTTL / 3)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := m.renew(ctx)
+		switch {
+		case err == nil:
+			renewed = time.Now()
+			continue
+		case ctx.Err() != nil:
+			return
+		case err != ErrMigrationsLockLost && time.Since(renewed) < m.lockTTL/2:
+			log.WithError(err).Warn("Failed to renew migrations lock, retrying")
+			continue
+		}
+
+		log.WithError(err).Error("Failed to renew migrations lock, cancelling migrations")
+		cancel()
+		return
+	}
+}
+
+func (m *Migrator) renew(ctx context.Context) error {
+	filter := bson.M{"_id": migrationsLockID, "owner": m.owner}
+	update := bson.M{"$set": bson.M{"expiresAt": time.Now().UTC().Add(m.lockTTL)}}
+
+	res, err := m.db.Collection(migrationsLockCollectionName).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrMigrationsLockLost
+	}
+
+	return nil
+}
+
+func (m *Migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": migrationsLockID, "owner": m.owner}
+
+	if _, err := m.db.Collection(migrationsLockCollectionName).DeleteOne(ctx, filter); err != nil {
+		log.WithError(err).Error("Failed to release migrations lock")
+	}
+}
@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/ratelimit"
+)
+
+const (
+	rateLimitsCollectionName = "rate-limits"
+)
+
+type rateLimit struct {
+	Tokens  float64 `bson:"tokens"`
+	Allowed bool    `bson:"allowed"`
+	Count   int     `bson:"count"`
+}
+
+// RateLimitStore keeps buckets and quotas of the rate limiter in Mongo, so
+// instances of the API limit callers together. Buckets are updated by update
+// pipelines, which need MongoDB 4.2.
+type RateLimitStore struct {
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+func NewRateLimitStore(uri string) *RateLimitStore {
+	client, db := connect(uri, "NewRateLimitStore")
+
+	return &RateLimitStore{
+		client,
+		db,
+	}
+}
+
+func (s *RateLimitStore) collectionIndexes() []collectionIndexes {
+	expireAt := int32(0)
+
+	return []collectionIndexes{
+		{
+			Collection: s.db.Collection(rateLimitsCollectionName),
+			Indexes: []index{
+				{Name: "expiresAt_ttl", Keys: bson.D{{Key: "expiresAt", Value: 1}}, ExpireAfter: &expireAt},
+			},
+		},
+	}
+}
+
+// Take refills and takes from the bucket in a single update, so concurrent requests cannot take the same token.
+func (s *RateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	burst := float64(limit.Burst)
+	elapsed := bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$at", now}}}}, 1000}}
+	fullIn := time.Duration(burst / limit.Rate * float64(time.Second))
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$tokens", burst}},
+				bson.M{"$multiply": bson.A{bson.M{"$max": bson.A{elapsed, 0}}, limit.Rate}},
+			}}}},
+			"at": bson.M{"$max": bson.A{now, bson.M{"$ifNull": bson.A{"$at", now}}}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"allowed": bson.M{"$gte": bson.A{"$tokens", 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":    bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expiresAt": now.Add(fullIn),
+		}}},
+	}
+
+	doc, err := s.update(ctx, "bucket "+key, pipeline)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return ratelimit.BucketResult(doc.Allowed, doc.Tokens, limit), nil
+}
+
+func (s *RateLimitStore) Count(ctx context.Context, key string, quota int, now time.Time) (ratelimit.Result, error) {
+	update := bson.M{
+		"$inc": bson.M{"count": 1},
+		// Counters are kept for a while after the day, in case clocks of instances differ.
+		"$setOnInsert": bson.M{"expiresAt": ratelimit.NextDay(now).Add(time.Hour)},
+	}
+
+	doc, err := s.update(ctx, "quota "+ratelimit.Day(now)+" "+key, update)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return ratelimit.QuotaResult(doc.Count, quota, now), nil
+}
+
+func (s *RateLimitStore) update(ctx context.Context, id string, update interface{}) (*rateLimit, error) {
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var doc rateLimit
+
+	err := s.db.Collection(rateLimitsCollectionName).FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&doc)
+
+	// Concurrent upserts of a new document race on its _id, the one that lost updates the document of the winner.
+	if isDuplicateKeyError(err) {
+		err = s.db.Collection(rateLimitsCollectionName).FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&doc)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
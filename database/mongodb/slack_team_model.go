@@ -1,6 +1,10 @@
 package mongodb
 
-import "time"
+import (
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+)
 
 type SlackIcon struct {
 	Image34      string `bson:"image34"`
@@ -13,8 +17,10 @@ type SlackIcon struct {
 	ImageDefault bool   `bson:"imageDefault"`
 }
 
+// slackTeam is a document of the slack-teams collection. Meteor keeps its own
+// `_id` there; the service only relies on the Slack team ID stored in `id`,
+// which migrations backfill for older documents.
 type slackTeam struct {
-	ID          string     `bson:"_id"`
 	TeamID      string     `bson:"id"`
 	Name        string     `bson:"name"`
 	Domain      string     `bson:"domain"`
@@ -23,5 +29,28 @@ type slackTeam struct {
 	IsDeleted   bool       `bson:"isDeleted"`
 	DeletedAt   *time.Time `bson:"deletedAt"`
 	CreatedAt   time.Time  `bson:"createdAt"`
-	Tags        *[]string  `bson:"enabled"`
+	Tags        *[]string  `bson:"tags"`
+}
+
+func (doc *slackTeam) toTeam() *rpc.SlackTeam {
+	return &rpc.SlackTeam{
+		ID:          doc.TeamID,
+		Name:        doc.Name,
+		Domain:      doc.Domain,
+		EmailDomain: doc.EmailDomain,
+		Icon: rpc.SlackIcon{
+			Image34:      doc.Icon.Image34,
+			Image44:      doc.Icon.Image44,
+			Image68:      doc.Icon.Image68,
+			Image88:      doc.Icon.Image88,
+			Image102:     doc.Icon.Image102,
+			Image132:     doc.Icon.Image132,
+			Image230:     doc.Icon.Image230,
+			ImageDefault: doc.Icon.ImageDefault,
+		},
+		IsDeleted: doc.IsDeleted,
+		DeletedAt: doc.DeletedAt,
+		CreatedAt: doc.CreatedAt,
+		Tags:      doc.Tags,
+	}
 }
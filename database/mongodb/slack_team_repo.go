@@ -2,7 +2,7 @@ package mongodb
 
 import (
 	"context"
-	"time"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 
@@ -10,7 +10,6 @@ import (
 	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -19,81 +18,98 @@ const (
 	slackTeamsCollectionName = "slack-teams"
 )
 
+// caseInsensitive is the collation of the search indexes, it must match the one used by queries.
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
 type slackTeamsRepository struct {
 	client *mongo.Client
 	db     *mongo.Database
 }
 
 func NewSlackTeamsRepository(uri string) rpc.SlackTeamsRepository {
-	clientOptions := options.Client()
-	clientOptions.SetConnectTimeout(time.Duration(60) * time.Second)
-	clientOptions.ApplyURI(uri)
-
-	client, err := mongo.NewClient(clientOptions)
+	client, db := connect(uri, "NewSlackTeamsRepository")
 
-	if err != nil {
-		log.WithError(err).Fatal()
+	return &slackTeamsRepository{
+		client,
+		db,
 	}
+}
 
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	err = client.Connect(ctx)
-	if err != nil {
-		log.WithError(err).Fatal()
+func (r *slackTeamsRepository) collectionIndexes() []collectionIndexes {
+	return []collectionIndexes{
+		{
+			Collection: r.db.Collection(slackTeamsCollectionName),
+			Indexes: []index{
+				{Name: "id_1", Keys: bson.D{{Key: "id", Value: 1}}},
+				{Name: "name_ci", Keys: bson.D{{Key: "name", Value: 1}}, Collation: caseInsensitive},
+				{Name: "domain_ci", Keys: bson.D{{Key: "domain", Value: 1}}, Collation: caseInsensitive},
+				{Name: "emailDomain_ci", Keys: bson.D{{Key: "emailDomain", Value: 1}}, Collation: caseInsensitive},
+			},
+			HotQueries: []hotQuery{
+				{Name: "FindTeamByID", Filter: bson.D{{Key: "id", Value: "T0"}}},
+				{Name: "SearchTeamsByDomain", Filter: bson.D{{Key: "domain", Value: prefixRange("acme")}}, Collation: caseInsensitive},
+			},
+		},
 	}
+}
 
-	connstr, err := connstring.Parse(uri)
+func (r *slackTeamsRepository) FindTeamByID(ctx context.Context, teamId string) (*rpc.SlackTeam, error) {
+	filter := bson.M{"id": teamId}
 
+	doc, err := r.findOne(ctx, filter)
 	if err != nil {
-		log.WithError(err).Fatal()
+		if err == mongo.ErrNoDocuments {
+			return nil, handler.ErrNotFound
+		}
+
+		log.WithContext(ctx).WithError(err).Debug()
+		return nil, err
 	}
 
-	// Check the connection
-	err = client.Ping(context.Background(), nil)
+	return doc.toTeam(), nil
+}
 
-	if err != nil {
-		log.WithError(err).Error("NewslackTeamsRepository client.Ping")
-	}
+// SearchTeams matches text fields by prefix under a case-insensitive collation,
+// so the queries use the collated indexes instead of unanchored regular expressions.
+func (r *slackTeamsRepository) SearchTeams(ctx context.Context, query rpc.TeamSearchQuery) (*rpc.TeamSearchResult, error) {
+	query = query.Normalize()
+	filter := teamSearchFilter(query)
 
-	db := client.Database(connstr.Database)
+	collection := r.db.Collection(slackTeamsCollectionName)
 
-	return &slackTeamsRepository{
-		client,
-		db,
+	total, err := collection.CountDocuments(ctx, filter, options.Count().SetCollation(caseInsensitive))
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Debug()
+		return nil, err
 	}
-}
 
-func (r *slackTeamsRepository) FindTeamByID(ctx context.Context, teamId string) (*rpc.SlackTeam, error) {
-	filter := bson.D{{"id", teamId}}
+	findOptions := options.Find().
+		SetCollation(caseInsensitive).
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "id", Value: 1}}).
+		SetSkip(int64(query.Offset)).
+		SetLimit(int64(query.Limit))
 
-	doc, err := r.findOne(ctx, filter)
+	cur, err := collection.Find(ctx, filter, findOptions)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, handler.ErrNotFound
-		}
+		log.WithContext(ctx).WithError(err).Debug()
+		return nil, err
+	}
 
+	var docs []*slackTeam
+	if err := cur.All(ctx, &docs); err != nil {
 		log.WithContext(ctx).WithError(err).Debug()
 		return nil, err
 	}
 
-	res := &rpc.SlackTeam{
-		ID: doc.TeamID,
-		Name: doc.Name,
-		Domain: doc.Domain,
-		EmailDomain: doc.EmailDomain,
-		Icon: rpc.SlackIcon{
-			Image34: doc.Icon.Image34,
-			Image44: doc.Icon.Image44,
-			Image68: doc.Icon.Image68,
-			Image88: doc.Icon.Image88,
-			Image102: doc.Icon.Image102,
-			Image132: doc.Icon.Image132,
-			Image230: doc.Icon.Image230,
-			ImageDefault: doc.Icon.ImageDefault,
-		},
-		IsDeleted: doc.IsDeleted,
-		DeletedAt: doc.DeletedAt,
-		CreatedAt: doc.CreatedAt,
-		Tags: doc.Tags,
+	res := &rpc.TeamSearchResult{
+		Teams:  make([]*rpc.SlackTeam, len(docs)),
+		Total:  total,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	}
+
+	for i, doc := range docs {
+		res.Teams[i] = doc.toTeam()
 	}
 
 	return res, nil
@@ -104,15 +120,7 @@ func (r *slackTeamsRepository) findOne(ctx context.Context, filter interface{})
 
 	collection := r.db.Collection(slackTeamsCollectionName)
 
-	findOptions := options.FindOne()
-
-	projection := bson.D{
-		{"scope", 0},
-	}
-
-	findOptions.SetProjection(projection)
-
-	err := collection.FindOne(ctx, filter, findOptions).Decode(&doc)
+	err := collection.FindOne(ctx, filter).Decode(&doc)
 	if err != nil {
 		log.WithContext(ctx).WithError(err).Debug()
 		return nil, err
@@ -122,3 +130,58 @@ func (r *slackTeamsRepository) findOne(ctx context.Context, filter interface{})
 
 	return doc, nil
 }
+
+func teamSearchFilter(q rpc.TeamSearchQuery) bson.M {
+	filter := bson.M{}
+
+	if q.Name != "" {
+		filter["name"] = prefixRange(q.Name)
+	}
+	if q.Domain != "" {
+		filter["domain"] = prefixRange(normalizeDomain(q.Domain))
+	}
+	if q.EmailDomain != "" {
+		filter["emailDomain"] = prefixRange(normalizeEmailDomain(q.EmailDomain))
+	}
+	if q.Query != "" {
+		filter["$or"] = bson.A{
+			bson.M{"name": prefixRange(q.Query)},
+			bson.M{"domain": prefixRange(normalizeDomain(q.Query))},
+			bson.M{"emailDomain": prefixRange(normalizeEmailDomain(q.Query))},
+		}
+	}
+	if q.IsDeleted != nil {
+		if *q.IsDeleted {
+			filter["isDeleted"] = true
+		} else {
+			// Older documents have no isDeleted field at all.
+			filter["isDeleted"] = bson.M{"$ne": true}
+		}
+	}
+	if len(q.Tags) > 0 {
+		filter["tags"] = bson.M{"$all": q.Tags}
+	}
+
+	return filter
+}
+
+// prefixRange matches strings starting with prefix. U+FFFF sorts after every
+// other character in ICU collations, which makes it a safe upper bound.
+func prefixRange(prefix string) bson.M {
+	return bson.M{"$gte": prefix, "$lt": prefix + "\uffff"}
+}
+
+// normalizeDomain turns "https://acme.slack.com/" into "acme".
+func normalizeDomain(domain string) string {
+	domain = strings.TrimSpace(domain)
+	domain = strings.TrimPrefix(domain, "https://")
+	domain = strings.TrimPrefix(domain, "http://")
+	domain = strings.TrimSuffix(domain, "/")
+
+	return strings.TrimSuffix(domain, ".slack.com")
+}
+
+// normalizeEmailDomain turns "@acme.com" into "acme.com".
+func normalizeEmailDomain(domain string) string {
+	return strings.TrimPrefix(strings.TrimSpace(domain), "@")
+}
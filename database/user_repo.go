@@ -2,6 +2,8 @@ package database
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/x509"
 
 	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
 	"bitbucket.org/iwlab-standuply/slackteams-api/config"
@@ -18,13 +20,49 @@ func NewLocalAuthRepository(users []config.User) auth.Repository {
 	}
 }
 
-func (r *userRepository) FindUserByToken(ctx context.Context, token string) (string, error) {
+func (r *userRepository) FindPrincipalByToken(ctx context.Context, token string) (*auth.Principal, error) {
 	for i := range r.users {
-		if r.users[i].Token == token {
+		if subtle.ConstantTimeCompare([]byte(r.users[i].Token), []byte(token)) == 1 {
 			log.Debugf("Found user %s", r.users[i].Name)
-			return r.users[i].Name, nil
+			return principal(r.users[i]), nil
 		}
 	}
 
-	return "", auth.ErrUserFound
+	return nil, auth.ErrUserNotFound
+}
+
+func principal(user config.User) *auth.Principal {
+	roles := config.SplitList(user.Roles)
+	if len(roles) == 0 {
+		roles = []string{user.Name}
+	}
+
+	p := &auth.Principal{Name: user.Name}
+	for _, role := range roles {
+		p.Roles = append(p.Roles, auth.Role(role))
+	}
+
+	return p
+}
+
+type certificateRepository struct {
+	users []config.User
+}
+
+// NewLocalCertificateRepository maps client certificates to users named as their subject common name.
+func NewLocalCertificateRepository(users []config.User) auth.CertificateRepository {
+	return &certificateRepository{
+		users,
+	}
+}
+
+func (r *certificateRepository) FindPrincipalByCertificate(ctx context.Context, cert *x509.Certificate) (*auth.Principal, error) {
+	for i := range r.users {
+		if r.users[i].Name == cert.Subject.CommonName {
+			log.Debugf("Found certificate user %s", r.users[i].Name)
+			return principal(r.users[i]), nil
+		}
+	}
+
+	return nil, auth.ErrUserNotFound
 }
@@ -0,0 +1,120 @@
+package errors
+
+import "fmt"
+
+// Kind classifies an error for the API response it turns into.
+type Kind string
+
+const (
+	KindInvalid          Kind = "invalid_request"
+	KindUnauthorized     Kind = "unauthorized"
+	KindForbidden        Kind = "forbidden"
+	KindNotFound         Kind = "not_found"
+	KindMethodNotAllowed Kind = "method_not_allowed"
+	KindConflict         Kind = "conflict"
+	KindGone             Kind = "gone"
+	KindRateLimited      Kind = "rate_limited"
+	KindInternal         Kind = "internal"
+	KindUnavailable      Kind = "unavailable"
+)
+
+// Error is an error of a known kind. Message is safe to show to API clients,
+// the wrapped error is not.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+// E makes an error of kind, usually a sentinel compared with ==.
+func E(kind Kind, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// WithKind wraps err into an error of kind with a message for clients.
+func WithKind(err error, kind Kind, message string) error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// kinds of the sentinel errors of this package.
+var kinds = map[error]Kind{
+	NotImplemented:  KindInternal,
+	UnableToResolve: KindInternal,
+	EmptyArgs:       KindInvalid,
+	NotFound:        KindNotFound,
+	NotAuthorized:   KindForbidden,
+	EmailUsed:       KindConflict,
+}
+
+// KindOf finds the kind of the first typed error in the chain of err.
+// Untyped errors are internal.
+func KindOf(err error) Kind {
+	if e := find(err); e != nil {
+		return e.Kind
+	}
+
+	for err != nil {
+		if kind, ok := kinds[err]; ok {
+			return kind
+		}
+		err = unwrap(err)
+	}
+
+	return KindInternal
+}
+
+// MessageOf returns the message of err that is safe to show to API clients.
+func MessageOf(err error) string {
+	if e := find(err); e != nil {
+		return e.Message
+	}
+
+	for e := err; e != nil; e = unwrap(e) {
+		if _, ok := kinds[e]; ok {
+			return e.Error()
+		}
+	}
+
+	return "internal error"
+}
+
+func find(err error) *Error {
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			return e
+		}
+		err = unwrap(err)
+	}
+
+	return nil
+}
+
+// unwrap steps down both Go 1.13 and github.com/pkg/errors chains.
+func unwrap(err error) error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	case interface{ Cause() error }:
+		if cause := e.Cause(); cause != err {
+			return cause
+		}
+	}
+
+	return nil
+}
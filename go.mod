@@ -4,6 +4,7 @@ go 1.14
 
 require (
 	github.com/anthonynsimon/bild v0.0.0-20190408162103-3a6867030b45
+	github.com/chai2010/webp v1.4.0
 	github.com/crgimenes/goconfig v1.2.1
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-stack/stack v1.8.0 // indirect
@@ -13,14 +14,15 @@ require (
 	github.com/marcuzy/rabbus v3.0.1-0.20190807124125-12951c005ee0+incompatible
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.7.1
 	github.com/rafaeljesus/retry-go v0.0.0-20171214204623-5981a380a879 // indirect
 	github.com/sirupsen/logrus v1.6.0
 	github.com/sony/gobreaker v0.4.1 // indirect
-	github.com/streadway/amqp v0.0.0-20200108173154-1c71cc93ed71 // indirect
+	github.com/streadway/amqp v0.0.0-20200108173154-1c71cc93ed71
 	github.com/xdg/scram v0.0.0-20180814205039-7eeb5667e42c // indirect
 	github.com/xdg/stringprep v1.0.0 // indirect
 	go.mongodb.org/mongo-driver v1.3.5
 	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de // indirect
-	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208 // indirect
-	golang.org/x/text v0.3.3 // indirect
+	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
+	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
 )
@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+var (
+	errOnlyPOST     = errors.E(errors.KindMethodNotAllowed, "only POST requests are supported")
+	errUnauthorized = errors.E(errors.KindUnauthorized, "authorization required")
+)
+
+// Handler executes GraphQL queries sent as JSON in POST requests.
+type Handler struct {
+	schema *graphql.Schema
+}
+
+func NewHandler(resolver *Resolver) (*Handler, error) {
+	s, err := graphql.ParseSchema(schema, resolver, graphql.MaxDepth(8))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{s}, nil
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.Error(w, r, errOnlyPOST)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
+	if !ok || len(user) == 0 {
+		response.Error(w, r, errUnauthorized)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, errors.WithKind(err, errors.KindInvalid, "bad request - JSON failed"))
+		return
+	}
+
+	res := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	// Batch resolvers fail with one error per item, report each of them at its own path.
+	res.Errors = collapseItemErrors(errors.Expand(res.Errors))
+
+	resp, err := json.Marshal(res)
+	if err != nil {
+		response.Error(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
+		return
+	}
+
+	response.JSON(w, resp, http.StatusOK)
+}
+
+// collapseItemErrors reports the errors of every field of a failed item once, at the path of the item.
+func collapseItemErrors(errs []*gqlerrors.QueryError) []*gqlerrors.QueryError {
+	res := errs[:0]
+	seen := map[*itemError]bool{}
+
+	for _, err := range errs {
+		item, ok := err.ResolverError.(*itemError)
+		if !ok {
+			res = append(res, err)
+			continue
+		}
+
+		if seen[item] {
+			continue
+		}
+		seen[item] = true
+
+		err.Path = err.Path[:len(err.Path)-1]
+		res = append(res, err)
+	}
+
+	return res
+}
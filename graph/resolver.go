@@ -0,0 +1,123 @@
+// Package graph serves teams and authorizations over GraphQL.
+package graph
+
+import (
+	"context"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// Resolver is the root resolver of the schema.
+type Resolver struct {
+	TeamsRepo  handler.TeamsRepository
+	AuthRepo   handler.AuthorizationsRepository
+	Duplicates *handler.DuplicatesResolver
+}
+
+func (r *Resolver) Team(ctx context.Context, args struct{ ID graphql.ID }) (*teamResolver, error) {
+	return r.team(ctx, string(args.ID))
+}
+
+// Teams resolves every team on its own. Teams that fail are null with their error, the others are kept.
+func (r *Resolver) Teams(ctx context.Context, args struct{ IDs []graphql.ID }) (*[]*teamResolver, error) {
+	res := make([]*teamResolver, len(args.IDs))
+
+	for i, id := range args.IDs {
+		team, err := r.team(ctx, string(id))
+		if err != nil {
+			team = &teamResolver{team: &rpc.SlackTeam{ID: string(id)}, err: &itemError{err}}
+		}
+
+		res[i] = team
+	}
+
+	return &res, nil
+}
+
+func (r *Resolver) Authorization(ctx context.Context, args struct{ TeamID graphql.ID }) (*authorizationResolver, error) {
+	return r.authorization(ctx, string(args.TeamID))
+}
+
+func (r *Resolver) Authorizations(ctx context.Context, args struct{ TeamIDs *[]graphql.ID }) (*[]*authorizationResolver, error) {
+	if args.TeamIDs == nil {
+		return r.allAuthorizations(ctx)
+	}
+
+	teamIDs := make([]string, len(*args.TeamIDs))
+	for i, id := range *args.TeamIDs {
+		teamIDs[i] = string(id)
+	}
+
+	batch, err := r.AuthRepo.GetAuthorizations(ctx, teamIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byTeam := make(map[string]*handler.SlackBotAuthorization, len(batch.Authorizations))
+	for _, a := range batch.Authorizations {
+		byTeam[a.TeamId] = a
+	}
+
+	res := make([]*authorizationResolver, len(teamIDs))
+	for i, teamID := range teamIDs {
+		if a, ok := byTeam[teamID]; ok {
+			res[i] = &authorizationResolver{a, r}
+		}
+	}
+
+	return &res, nil
+}
+
+func (r *Resolver) allAuthorizations(ctx context.Context) (*[]*authorizationResolver, error) {
+	auths, err := r.AuthRepo.GetAllAuthorizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	auths = r.Duplicates.Resolve(auths)
+
+	res := make([]*authorizationResolver, len(auths))
+	for i, a := range auths {
+		res[i] = &authorizationResolver{a, r}
+	}
+
+	return &res, nil
+}
+
+// team resolves a team, a team that is not found is null rather than an error.
+func (r *Resolver) team(ctx context.Context, teamID string) (*teamResolver, error) {
+	team, err := r.TeamsRepo.FindTeamByID(ctx, teamID)
+	switch err {
+	case nil:
+		return &teamResolver{team: team}, nil
+	case handler.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func (r *Resolver) authorization(ctx context.Context, teamID string) (*authorizationResolver, error) {
+	a, err := r.AuthRepo.GetAuthorization(ctx, teamID)
+	switch err {
+	case nil:
+		return &authorizationResolver{a, r}, nil
+	case handler.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// token hides a token field from users that may not read tokens.
+func token(ctx context.Context, value string) (*string, error) {
+	if p, _ := auth.PrincipalFromContext(ctx); !p.Can(auth.PermReadTokens) {
+		return nil, errors.NotAuthorized
+	}
+
+	return &value, nil
+}
@@ -0,0 +1,63 @@
+package graph
+
+const schema = `
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	team(id: ID!): SlackTeam
+	# teams returns teams in the order of ids, null for teams that are not found.
+	teams(ids: [ID!]!): [SlackTeam]
+	authorization(teamId: ID!): SlackBotAuthorization
+	# authorizations returns the authorizations of teamIds, null for teams without one,
+	# or all enabled authorizations without duplicates when teamIds is omitted.
+	authorizations(teamIds: [ID!]): [SlackBotAuthorization]
+}
+
+type SlackTeam {
+	id: ID!
+	name: String!
+	domain: String!
+	emailDomain: String!
+	icon: SlackIcon!
+	isDeleted: Boolean!
+	deletedAt: Time
+	createdAt: Time!
+	tags: [String!]
+}
+
+type SlackIcon {
+	image34: String!
+	image44: String!
+	image68: String!
+	image88: String!
+	image102: String!
+	image132: String!
+	image230: String!
+	imageDefault: Boolean!
+}
+
+type SlackBotAuthorization {
+	id: ID!
+	# accessToken is only visible to the bot.
+	accessToken: String
+	scope: String!
+	userId: String!
+	teamName: String!
+	teamId: ID!
+	team: SlackTeam
+	createdAt: String!
+	updatedAt: String
+	enabled: Boolean!
+	bot: BotInfo!
+}
+
+type BotInfo {
+	botUserId: String!
+	# botAccessToken is only visible to the bot.
+	botAccessToken: String
+}
+`
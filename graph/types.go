@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"context"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// teamResolver resolves a team. A team that failed to load carries an itemError, every field
+// answers it, so the team is null in a list and the error is reported once at its index.
+type teamResolver struct {
+	team *rpc.SlackTeam
+	err  error
+}
+
+// itemError is the error of a list item that failed to load while the others did.
+type itemError struct {
+	cause error
+}
+
+func (e *itemError) Error() string { return e.cause.Error() }
+func (e *itemError) Cause() error  { return e.cause }
+
+func (r *teamResolver) ID() (graphql.ID, error)      { return graphql.ID(r.team.ID), r.err }
+func (r *teamResolver) Name() (string, error)        { return r.team.Name, r.err }
+func (r *teamResolver) Domain() (string, error)      { return r.team.Domain, r.err }
+func (r *teamResolver) EmailDomain() (string, error) { return r.team.EmailDomain, r.err }
+func (r *teamResolver) Icon() (*iconResolver, error) { return &iconResolver{r.team.Icon}, r.err }
+func (r *teamResolver) IsDeleted() (bool, error)     { return r.team.IsDeleted, r.err }
+func (r *teamResolver) CreatedAt() (graphql.Time, error) {
+	return graphql.Time{Time: r.team.CreatedAt}, r.err
+}
+
+func (r *teamResolver) DeletedAt() (*graphql.Time, error) {
+	if r.team.DeletedAt == nil {
+		return nil, r.err
+	}
+
+	return &graphql.Time{Time: *r.team.DeletedAt}, r.err
+}
+
+func (r *teamResolver) Tags() (*[]string, error) {
+	return r.team.Tags, r.err
+}
+
+type iconResolver struct {
+	icon rpc.SlackIcon
+}
+
+func (r *iconResolver) Image34() string    { return r.icon.Image34 }
+func (r *iconResolver) Image44() string    { return r.icon.Image44 }
+func (r *iconResolver) Image68() string    { return r.icon.Image68 }
+func (r *iconResolver) Image88() string    { return r.icon.Image88 }
+func (r *iconResolver) Image102() string   { return r.icon.Image102 }
+func (r *iconResolver) Image132() string   { return r.icon.Image132 }
+func (r *iconResolver) Image230() string   { return r.icon.Image230 }
+func (r *iconResolver) ImageDefault() bool { return r.icon.ImageDefault }
+
+type authorizationResolver struct {
+	auth *handler.SlackBotAuthorization
+	root *Resolver
+}
+
+func (r *authorizationResolver) ID() graphql.ID     { return graphql.ID(r.auth.ID) }
+func (r *authorizationResolver) Scope() string      { return r.auth.Scope }
+func (r *authorizationResolver) UserID() string     { return r.auth.UserId }
+func (r *authorizationResolver) TeamName() string   { return r.auth.TeamName }
+func (r *authorizationResolver) TeamID() graphql.ID { return graphql.ID(r.auth.TeamId) }
+func (r *authorizationResolver) CreatedAt() string  { return r.auth.CreatedAt }
+func (r *authorizationResolver) UpdatedAt() *string {
+	if r.auth.UpdatedAt == "" {
+		return nil
+	}
+
+	return &r.auth.UpdatedAt
+}
+
+func (r *authorizationResolver) Enabled() bool     { return r.auth.Enabled }
+func (r *authorizationResolver) Bot() *botResolver { return &botResolver{r.auth.Bot} }
+
+func (r *authorizationResolver) AccessToken(ctx context.Context) (*string, error) {
+	return token(ctx, r.auth.AccessToken)
+}
+
+func (r *authorizationResolver) Team(ctx context.Context) (*teamResolver, error) {
+	return r.root.team(ctx, r.auth.TeamId)
+}
+
+type botResolver struct {
+	bot handler.BotInfo
+}
+
+func (r *botResolver) BotUserID() string { return r.bot.BotUserId }
+
+func (r *botResolver) BotAccessToken(ctx context.Context) (*string, error) {
+	return token(ctx, r.bot.BotAccessToken)
+}
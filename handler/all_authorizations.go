@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -14,12 +20,14 @@ type BotInfo struct {
 }
 
 type SlackBotAuthorization struct {
+	ID          string  `json:"id"`
 	AccessToken string  `json:"accessToken"`
 	Scope       string  `json:"scope"`
 	UserId      string  `json:"userId"`
 	TeamName    string  `json:"teamName"`
 	TeamId      string  `json:"teamId"`
 	CreatedAt   string  `json:"createdAt"`
+	UpdatedAt   string  `json:"updatedAt,omitempty"`
 	Enabled     bool    `json:"enabled"`
 	Bot         BotInfo `json:"bot"`
 
@@ -27,18 +35,41 @@ type SlackBotAuthorization struct {
 	// cloned *string
 }
 
+// MaskToken hides a token but for its type prefix and last characters, like xoxb-…abcd,
+// which is enough to tell tokens apart. Short tokens are hidden whole.
+func MaskToken(token string) string {
+	if len(token) < 12 {
+		return "…"
+	}
+
+	prefix := ""
+	if i := strings.Index(token, "-"); i > 0 && i <= 5 {
+		prefix = token[:i+1]
+	}
+
+	return prefix + "…" + token[len(token)-4:]
+}
+
+// AllAuthorizations serves all enabled authorizations, one per team.
+//
+// Query params: fields.
 type AllAuthorizations struct {
-	Repo AuthorizationsRepository
+	Repo     AuthorizationsRepository
+	Resolver *DuplicatesResolver
+	// Journal tells when authorizations last changed for Last-Modified, the header is left out without it.
+	Journal AuthorizationsSyncRepository
+	// Legacy serves tokens in clear as the route did before fields were selectable.
+	Legacy bool
 }
 
 type result struct {
-	OK    bool                     `json:"ok"`
-	Auths []*SlackBotAuthorization `json:"auths"`
+	OK    bool          `json:"ok"`
+	Auths []interface{} `json:"auths"`
 }
 
 func (h AllAuthorizations) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		respond(w, errorJSON("only GET requests are supported"), http.StatusMethodNotAllowed)
+		respondError(w, r, errOnlyGET)
 		return
 	}
 
@@ -46,52 +77,99 @@ func (h AllAuthorizations) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
 	if !ok || len(user) == 0 {
-		respond(w, errorJSON("server error"), http.StatusInternalServerError)
+		respondError(w, r, errUnauthorized)
+		return
+	}
+
+	view, r, err := authorizationView(r, h.Legacy)
+	if err != nil {
+		respondError(w, r, err)
 		return
 	}
 
-	auths, err := h.Repo.GetAllAuthorizations(ctx)
+	// Read before the authorizations, so changes made in between make the time older rather than newer.
+	modTime := h.lastModified(r)
+
+	auths, err := h.Repo.GetAllAuthorizations(r.Context())
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "DB request failed"))
+		return
+	}
 	log.WithContext(ctx).Debugf("auths size: %d\n", len(auths))
-	log.WithContext(ctx).Debugf("auth: %+v\n", auths[0])
 
+	auths = h.Resolver.Resolve(auths)
+	rendered := view.RenderAll(auths)
+
+	etag, err := authorizationsETag(rendered)
 	if err != nil {
-		respond(w, errorJSON("server error - DB request failed"), http.StatusInternalServerError)
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
+		return
+	}
+
+	if notModified(r, etag, modTime) {
+		writeNotModified(w, etag, modTime)
 		return
 	}
 
 	res := result{
 		OK:    true,
-		Auths: removeDuplicates(auths),
+		Auths: rendered,
 	}
 
 	resp, err := json.Marshal(res)
 	if err != nil {
-		respond(w, errorJSON("server error - JSON failed"), http.StatusInternalServerError)
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
 		return
 	}
 	log.WithContext(ctx).Debugf("resp size: %d\n", len(resp))
 
+	w.Header().Set("ETag", etag)
+	setLastModified(w, modTime)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
 	respond(w, resp, http.StatusOK)
 }
 
-func removeDuplicates(elements []*SlackBotAuthorization) []*SlackBotAuthorization {
-	// Use map to record duplicates as we find them.
-	encountered := map[string]bool{}
-	result := make([]*SlackBotAuthorization, len(elements))
-	i := 0
-
-	for v := range elements {
-		if encountered[elements[v].TeamId] == true {
-			// Do not add duplicate.
-		} else {
-			// Record this element as an encountered element.
-			encountered[elements[v].TeamId] = true
-			// Append to result slice.
-			result[i] = elements[v]
-			i++
+// lastModified is the time of the last change in the journal. It is left out while changes of its second
+// may still come, as HTTP dates cannot tell them apart, and when the journal fails.
+func (h AllAuthorizations) lastModified(r *http.Request) time.Time {
+	if h.Journal == nil {
+		return time.Time{}
+	}
+
+	t, err := h.Journal.LastModified(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Warn("Failed to read when authorizations last changed")
+		return time.Time{}
+	}
+
+	if time.Since(t) < 2*time.Second {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// authorizationsETag hashes the rendered authorizations regardless of their order,
+// so it changes whenever an authorization is added, changed or removed, or other fields are selected.
+func authorizationsETag(auths []interface{}) (string, error) {
+	items := make([]string, len(auths))
+
+	for i, a := range auths {
+		b, err := json.Marshal(a)
+		if err != nil {
+			return "", err
 		}
+		items[i] = string(b)
+	}
+
+	sort.Strings(items)
+
+	h := sha256.New()
+	for _, item := range items {
+		h.Write([]byte(item))
+		h.Write([]byte{'\n'})
 	}
 
-	// Return the new slice.
-	return result[:i]
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
 }
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/sse"
+	log "github.com/sirupsen/logrus"
+)
+
+// AuthorizationEvents streams changes of authorizations as Server-Sent Events.
+// Event types are the change kinds and event IDs are sync cursors, so a client
+// that reconnects with Last-Event-ID gets the changes it missed first.
+//
+// A stream ends after MaxDuration, which should be shorter than the server write
+// timeout, and when the client falls behind; clients reconnect and resume.
+type AuthorizationEvents struct {
+	Broker      *sse.Broker
+	Repo        AuthorizationsSyncRepository
+	Heartbeat   time.Duration
+	MaxDuration time.Duration
+}
+
+// NewAuthorizationEvent makes the event pushed to clients for a change.
+func NewAuthorizationEvent(change AuthorizationChange) (sse.Event, error) {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return sse.Event{}, err
+	}
+
+	return sse.Event{
+		ID:   change.Cursor,
+		Type: string(change.Kind),
+		Data: data,
+	}, nil
+}
+
+func (h AuthorizationEvents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		respondError(w, r, errOnlyGET)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
+	if !ok || len(user) == 0 {
+		respondError(w, r, errUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, r, errors.E(errors.KindInternal, "streaming unsupported"))
+		return
+	}
+
+	// Subscribe before reading missed changes, so nothing falls between the two.
+	sub := h.Broker.Subscribe()
+	defer h.Broker.Unsubscribe(sub)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	var missed []AuthorizationChange
+
+	for cursor := lastEventID; cursor != ""; {
+		delta, err := h.Repo.AuthorizationsSince(ctx, cursor, maxSyncLimit)
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+
+		missed = append(missed, delta.Changes...)
+
+		if !delta.HasMore {
+			break
+		}
+		cursor = delta.Cursor
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Changes read from the journal may be published live again, they are sent once.
+	sent := make(map[string]bool, len(missed))
+
+	for _, change := range missed {
+		event, err := NewAuthorizationEvent(change)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to encode authorization event")
+			continue
+		}
+
+		if err := sse.Write(w, event); err != nil {
+			return
+		}
+		sent[event.ID] = true
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+
+	deadline := time.NewTimer(h.MaxDuration)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline.C:
+			return
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				log.WithContext(ctx).Warn("Authorization events client fell behind, dropped")
+				return
+			}
+
+			if sent[event.ID] {
+				delete(sent, event.ID)
+				continue
+			}
+
+			if err := sse.Write(w, event); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
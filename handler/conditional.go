@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// notModified evaluates If-None-Match and If-Modified-Since of a GET request
+// against the current ETag and modification time of a resource.
+// As in RFC 7232, If-Modified-Since is ignored when If-None-Match is present.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return etagMatches(match, etag)
+	}
+
+	since := r.Header.Get("If-Modified-Since")
+	if since == "" || modTime.IsZero() {
+		return false
+	}
+
+	t, err := http.ParseTime(since)
+	if err != nil {
+		return false
+	}
+
+	// HTTP dates have a resolution of seconds.
+	return !modTime.Truncate(time.Second).After(t)
+}
+
+// etagMatches compares etags weakly, which is what RFC 7232 asks for in If-None-Match.
+func etagMatches(header string, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setLastModified sets Last-Modified unless modTime is unknown.
+func setLastModified(w http.ResponseWriter, modTime time.Time) {
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+func writeNotModified(w http.ResponseWriter, etag string, modTime time.Time) {
+	w.Header().Set("ETag", etag)
+	setLastModified(w, modTime)
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DuplicateAuthorizations reports teams with several enabled authorizations
+// and which one of them is served to the bot.
+type DuplicateAuthorizations struct {
+	Repo     AuthorizationsRepository
+	Resolver *DuplicatesResolver
+}
+
+type duplicatesResult struct {
+	OK    bool              `json:"ok"`
+	Teams []DuplicateReport `json:"teams"`
+}
+
+func (h DuplicateAuthorizations) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		respondError(w, r, errOnlyGET)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
+	if !ok || len(user) == 0 {
+		respondError(w, r, errUnauthorized)
+		return
+	}
+
+	auths, err := h.Repo.GetAllAuthorizations(ctx)
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "DB request failed"))
+		return
+	}
+
+	res := duplicatesResult{
+		OK:    true,
+		Teams: h.Resolver.Report(auths),
+	}
+	log.WithContext(ctx).Debugf("teams with duplicates: %d\n", len(res.Teams))
+
+	resp, err := json.Marshal(res)
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
+		return
+	}
+
+	respond(w, resp, http.StatusOK)
+}
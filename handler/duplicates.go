@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DuplicateRule is a single criterion used to choose between several enabled
+// authorizations of the same team.
+type DuplicateRule string
+
+const (
+	// DuplicateRuleScopes prefers authorizations granted all the required scopes.
+	DuplicateRuleScopes DuplicateRule = "scopes"
+	// DuplicateRuleBot prefers authorizations that carry a bot access token.
+	DuplicateRuleBot DuplicateRule = "bot"
+	// DuplicateRuleNewest prefers the most recently created authorization.
+	DuplicateRuleNewest DuplicateRule = "newest"
+)
+
+// DuplicatesResolver picks a single authorization per team by applying the
+// configured rules in order. Ties left after all rules are broken by ID so
+// the result never depends on the order documents come from Mongo.
+type DuplicatesResolver struct {
+	rules          []DuplicateRule
+	requiredScopes []string
+}
+
+func NewDuplicatesResolver(rules []string, requiredScopes []string) (*DuplicatesResolver, error) {
+	r := &DuplicatesResolver{
+		requiredScopes: requiredScopes,
+	}
+
+	for _, rule := range rules {
+		switch DuplicateRule(rule) {
+		case DuplicateRuleScopes, DuplicateRuleBot, DuplicateRuleNewest:
+			r.rules = append(r.rules, DuplicateRule(rule))
+		default:
+			return nil, fmt.Errorf("unknown duplicate rule: '%s'", rule)
+		}
+	}
+
+	return r, nil
+}
+
+// Resolve returns one authorization per team, keeping the order in which
+// teams first appear in elements.
+func (r *DuplicatesResolver) Resolve(elements []*SlackBotAuthorization) []*SlackBotAuthorization {
+	groups, order := groupByTeam(elements)
+	result := make([]*SlackBotAuthorization, 0, len(order))
+
+	for _, teamId := range order {
+		result = append(result, r.pick(groups[teamId]))
+	}
+
+	return result
+}
+
+// Winner returns the authorization Resolve would keep for a single team.
+func (r *DuplicatesResolver) Winner(elements []*SlackBotAuthorization) *SlackBotAuthorization {
+	if len(elements) == 0 {
+		return nil
+	}
+
+	return r.pick(elements)
+}
+
+type DuplicateCandidate struct {
+	ID          string `json:"id"`
+	UserId      string `json:"userId"`
+	Scope       string `json:"scope"`
+	CreatedAt   string `json:"createdAt"`
+	HasBotToken bool   `json:"hasBotToken"`
+}
+
+type DuplicateReport struct {
+	TeamId     string               `json:"teamId"`
+	TeamName   string               `json:"teamName"`
+	Winner     DuplicateCandidate   `json:"winner"`
+	Candidates []DuplicateCandidate `json:"candidates"`
+}
+
+// Report lists the teams that have more than one enabled authorization and
+// which of them wins. Candidates are sorted in the order of preference.
+func (r *DuplicatesResolver) Report(elements []*SlackBotAuthorization) []DuplicateReport {
+	groups, order := groupByTeam(elements)
+	reports := []DuplicateReport{}
+
+	for _, teamId := range order {
+		group := groups[teamId]
+		if len(group) < 2 {
+			continue
+		}
+
+		sorted := r.sort(group)
+		report := DuplicateReport{
+			TeamId:     teamId,
+			TeamName:   sorted[0].TeamName,
+			Winner:     newDuplicateCandidate(sorted[0]),
+			Candidates: make([]DuplicateCandidate, len(sorted)),
+		}
+
+		for i, a := range sorted {
+			report.Candidates[i] = newDuplicateCandidate(a)
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports
+}
+
+func (r *DuplicatesResolver) pick(group []*SlackBotAuthorization) *SlackBotAuthorization {
+	if len(group) == 1 {
+		return group[0]
+	}
+
+	return r.sort(group)[0]
+}
+
+func (r *DuplicatesResolver) sort(group []*SlackBotAuthorization) []*SlackBotAuthorization {
+	sorted := make([]*SlackBotAuthorization, len(group))
+	copy(sorted, group)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return r.less(sorted[i], sorted[j])
+	})
+
+	return sorted
+}
+
+// less reports whether a is preferred over b.
+func (r *DuplicatesResolver) less(a, b *SlackBotAuthorization) bool {
+	for _, rule := range r.rules {
+		switch rule {
+		case DuplicateRuleScopes:
+			if ha, hb := r.hasRequiredScopes(a), r.hasRequiredScopes(b); ha != hb {
+				return ha
+			}
+		case DuplicateRuleBot:
+			if ha, hb := len(a.Bot.BotAccessToken) > 0, len(b.Bot.BotAccessToken) > 0; ha != hb {
+				return ha
+			}
+		case DuplicateRuleNewest:
+			if ta, tb := parseCreatedAt(a), parseCreatedAt(b); !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+		}
+	}
+
+	return a.ID < b.ID
+}
+
+func (r *DuplicatesResolver) hasRequiredScopes(a *SlackBotAuthorization) bool {
+	granted := map[string]bool{}
+	for _, s := range strings.Split(a.Scope, ",") {
+		granted[strings.TrimSpace(s)] = true
+	}
+
+	for _, s := range r.requiredScopes {
+		if !granted[s] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func groupByTeam(elements []*SlackBotAuthorization) (map[string][]*SlackBotAuthorization, []string) {
+	groups := map[string][]*SlackBotAuthorization{}
+	order := []string{}
+
+	for _, a := range elements {
+		if _, ok := groups[a.TeamId]; !ok {
+			order = append(order, a.TeamId)
+		}
+		groups[a.TeamId] = append(groups[a.TeamId], a)
+	}
+
+	return groups, order
+}
+
+func parseCreatedAt(a *SlackBotAuthorization) time.Time {
+	t, err := time.Parse(time.RFC3339, a.CreatedAt)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+func newDuplicateCandidate(a *SlackBotAuthorization) DuplicateCandidate {
+	return DuplicateCandidate{
+		ID:          a.ID,
+		UserId:      a.UserId,
+		Scope:       a.Scope,
+		CreatedAt:   a.CreatedAt,
+		HasBotToken: len(a.Bot.BotAccessToken) > 0,
+	}
+}
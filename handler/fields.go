@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+)
+
+// Fields of SlackBotAuthorization by their JSON names, nested ones by their path.
+const (
+	FieldID             = "id"
+	FieldAccessToken    = "accessToken"
+	FieldScope          = "scope"
+	FieldUserID         = "userId"
+	FieldTeamName       = "teamName"
+	FieldTeamID         = "teamId"
+	FieldCreatedAt      = "createdAt"
+	FieldUpdatedAt      = "updatedAt"
+	FieldEnabled        = "enabled"
+	FieldBotUserID      = "bot.botUserId"
+	FieldBotAccessToken = "bot.botAccessToken"
+)
+
+// AuthorizationFieldNames are all fields of SlackBotAuthorization in the order of the struct.
+var AuthorizationFieldNames = []string{
+	FieldID,
+	FieldAccessToken,
+	FieldScope,
+	FieldUserID,
+	FieldTeamName,
+	FieldTeamID,
+	FieldCreatedAt,
+	FieldUpdatedAt,
+	FieldEnabled,
+	FieldBotUserID,
+	FieldBotAccessToken,
+}
+
+// fieldGroups are names standing for several fields.
+var fieldGroups = map[string][]string{
+	"bot": {FieldBotUserID, FieldBotAccessToken},
+}
+
+type ctxKeyFields struct{}
+
+// AuthorizationFields is a selection of fields of authorizations. Nil selects all of them.
+type AuthorizationFields map[string]bool
+
+// ParseAuthorizationFields reads a selection, names may be comma-separated.
+// No names at all select all fields.
+func ParseAuthorizationFields(names []string) (AuthorizationFields, error) {
+	var f AuthorizationFields
+
+	for _, list := range names {
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			if f == nil {
+				f = AuthorizationFields{}
+			}
+
+			if group, ok := fieldGroups[name]; ok {
+				for _, field := range group {
+					f[field] = true
+				}
+				continue
+			}
+
+			if !isAuthorizationField(name) {
+				return nil, errors.E(errors.KindInvalid, "bad param - unknown field '"+name+"'")
+			}
+
+			f[name] = true
+		}
+	}
+
+	return f, nil
+}
+
+func isAuthorizationField(name string) bool {
+	for _, field := range AuthorizationFieldNames {
+		if field == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Has reports whether the field is selected.
+func (f AuthorizationFields) Has(field string) bool {
+	return f == nil || f[field]
+}
+
+// Listed reports whether the field was selected by its name, rather than by selecting all fields.
+func (f AuthorizationFields) Listed(field string) bool {
+	return f[field]
+}
+
+// WithAuthorizationFields tells repositories which fields of authorizations the caller needs,
+// they may leave the others out.
+func WithAuthorizationFields(ctx context.Context, f AuthorizationFields) context.Context {
+	return context.WithValue(ctx, ctxKeyFields{}, f)
+}
+
+// AuthorizationFieldsFromContext returns the fields WithAuthorizationFields selected, all by default.
+func AuthorizationFieldsFromContext(ctx context.Context) AuthorizationFields {
+	f, _ := ctx.Value(ctxKeyFields{}).(AuthorizationFields)
+	return f
+}
+
+// AuthorizationView is how authorizations are shown to a caller: only the selected fields,
+// with tokens in clear only when the caller asked for them by name and may read them.
+type AuthorizationView struct {
+	Fields AuthorizationFields
+	// RevealTokens shows listed token fields in clear, the others are masked.
+	RevealTokens bool
+}
+
+// NewAuthorizationView makes the view of the principal in ctx.
+func NewAuthorizationView(ctx context.Context, f AuthorizationFields) AuthorizationView {
+	p, _ := auth.PrincipalFromContext(ctx)
+
+	return AuthorizationView{
+		Fields:       f,
+		RevealTokens: p.Can(auth.PermReadTokens),
+	}
+}
+
+// legacyAuthorizationView shows all fields in clear unless some are selected, as routes did before
+// fields were selectable. Such routes must require auth.PermReadTokens.
+func legacyAuthorizationView(f AuthorizationFields) AuthorizationView {
+	if f == nil {
+		f = AuthorizationFields{}
+		for _, field := range AuthorizationFieldNames {
+			f[field] = true
+		}
+	}
+
+	return AuthorizationView{Fields: f, RevealTokens: true}
+}
+
+// authorizationView reads the fields param of r, legacy routes get legacyAuthorizationView.
+// The returned request tells repositories about the fields.
+func authorizationView(r *http.Request, legacy bool) (AuthorizationView, *http.Request, error) {
+	f, err := ParseAuthorizationFields(r.URL.Query()["fields"])
+	if err != nil {
+		return AuthorizationView{}, r, err
+	}
+
+	r = r.WithContext(WithAuthorizationFields(r.Context(), f))
+
+	if legacy {
+		return legacyAuthorizationView(f), r, nil
+	}
+
+	return NewAuthorizationView(r.Context(), f), r, nil
+}
+
+// Render returns what the caller gets for a: a itself with tokens masked as needed when all fields
+// are selected, or a JSON object of the selected fields.
+func (v AuthorizationView) Render(a *SlackBotAuthorization) interface{} {
+	c := *a
+	c.AccessToken = v.token(FieldAccessToken, c.AccessToken)
+	c.Bot.BotAccessToken = v.token(FieldBotAccessToken, c.Bot.BotAccessToken)
+
+	if v.selectsAll() {
+		return &c
+	}
+
+	res := map[string]interface{}{}
+	bot := map[string]interface{}{}
+
+	for field, value := range map[string]interface{}{
+		FieldID:             c.ID,
+		FieldAccessToken:    c.AccessToken,
+		FieldScope:          c.Scope,
+		FieldUserID:         c.UserId,
+		FieldTeamName:       c.TeamName,
+		FieldTeamID:         c.TeamId,
+		FieldCreatedAt:      c.CreatedAt,
+		FieldUpdatedAt:      c.UpdatedAt,
+		FieldEnabled:        c.Enabled,
+		FieldBotUserID:      c.Bot.BotUserId,
+		FieldBotAccessToken: c.Bot.BotAccessToken,
+	} {
+		if !v.Fields.Has(field) || field == FieldUpdatedAt && c.UpdatedAt == "" {
+			continue
+		}
+
+		if name := strings.TrimPrefix(field, "bot."); name != field {
+			bot[name] = value
+		} else {
+			res[field] = value
+		}
+	}
+
+	if len(bot) > 0 {
+		res["bot"] = bot
+	}
+
+	return res
+}
+
+// RenderAll renders auths in their order.
+func (v AuthorizationView) RenderAll(auths []*SlackBotAuthorization) []interface{} {
+	res := make([]interface{}, len(auths))
+	for i, a := range auths {
+		res[i] = v.Render(a)
+	}
+
+	return res
+}
+
+func (v AuthorizationView) selectsAll() bool {
+	for _, field := range AuthorizationFieldNames {
+		if !v.Fields.Has(field) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (v AuthorizationView) token(field string, token string) string {
+	if token == "" || v.RevealTokens && v.Fields.Listed(field) {
+		return token
+	}
+
+	return MaskToken(token)
+}
@@ -2,27 +2,32 @@ package handler
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 
 	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-var ErrNotFound = errors.New("GetAuthorization: no documents in result")
+var ErrNotFound = errors.E(errors.KindNotFound, "not found")
 
+// GetAuthorization serves the authorization of a team.
+//
+// Path params: teamId. Query params: fields.
 type GetAuthorization struct {
 	Repo AuthorizationsRepository
+	// Legacy serves tokens in clear as the route did before fields were selectable.
+	Legacy bool
 }
 
 type resultSingle struct {
-	OK   bool                   `json:"ok"`
-	Auth *SlackBotAuthorization `json:"auth"`
+	OK   bool        `json:"ok"`
+	Auth interface{} `json:"auth"`
 }
 
 func (h GetAuthorization) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		respond(w, errorJSON("only GET requests are supported"), http.StatusMethodNotAllowed)
+		respondError(w, r, errOnlyGET)
 		return
 	}
 
@@ -30,33 +35,40 @@ func (h GetAuthorization) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
 	if !ok || len(user) == 0 {
-		respond(w, errorJSON("server error"), http.StatusInternalServerError)
+		respondError(w, r, errUnauthorized)
 		return
 	}
 
-	v := r.URL.Query()
-	teamId := v["teamId"]
+	teamId := teamIDParam(r)
 	if len(teamId) == 0 {
-		respond(w, errorJSON("server error - no param"), http.StatusInternalServerError)
+		respondError(w, r, errNoTeamID)
 		return
 	}
 
-	auth, err := h.Repo.GetAuthorization(ctx, teamId[0])
+	view, r, err := authorizationView(r, h.Legacy)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	auth, err := h.Repo.GetAuthorization(r.Context(), teamId)
 	log.WithContext(ctx).Debugf("auth: %+v\n", auth)
 
 	if err != nil && err != ErrNotFound {
-		respond(w, errorJSON("server error - DB request failed"), http.StatusInternalServerError)
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "DB request failed"))
 		return
 	}
 
 	res := resultSingle{
-		OK:   err == nil,
-		Auth: auth,
+		OK: err == nil,
+	}
+	if auth != nil {
+		res.Auth = view.Render(auth)
 	}
 
 	resp, err := json.Marshal(res)
 	if err != nil {
-		respond(w, errorJSON("server error - JSON failed"), http.StatusInternalServerError)
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
 		return
 	}
 	log.WithContext(ctx).Debugf("resp size: %d\n", len(resp))
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxBatchTeamIDs bounds a bulk lookup, so it stays a single cheap query.
+const MaxBatchTeamIDs = 1000
+
+// maxBatchBodyBytes fits MaxBatchTeamIDs of the longest Slack team IDs with room to spare.
+const maxBatchBodyBytes = 64 << 10
+
+var (
+	errOnlyPOST       = errors.E(errors.KindMethodNotAllowed, "only POST requests are supported")
+	errNoTeamIDs      = errors.E(errors.KindInvalid, "bad param - no teamIds")
+	errTooManyTeamIDs = errors.E(errors.KindInvalid, "bad param - too many teamIds")
+	errEmptyTeamID    = errors.E(errors.KindInvalid, "empty team ID")
+)
+
+// GetAuthorizations serves the authorizations of many teams at once.
+//
+// Body: {"teamIds": [...]}, at most MaxBatchTeamIDs of them. Query params: fields.
+type GetAuthorizations struct {
+	Repo AuthorizationsRepository
+}
+
+type batchRequest struct {
+	TeamIDs []string `json:"teamIds"`
+}
+
+type resultBatch struct {
+	OK bool `json:"ok"`
+	*AuthorizationsLookup
+}
+
+// AuthorizationsLookup is what a bulk lookup answers.
+type AuthorizationsLookup struct {
+	Auths []interface{} `json:"auths"`
+	// Missing are team IDs without an enabled authorization.
+	Missing []string `json:"missing"`
+	// Errors are the team IDs that were not looked up, by their index in the request.
+	Errors []itemError `json:"errors,omitempty"`
+}
+
+type itemError struct {
+	Index   int         `json:"index"`
+	Code    errors.Kind `json:"code"`
+	Message string      `json:"message"`
+}
+
+func (h GetAuthorizations) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		respondError(w, r, errOnlyPOST)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
+	if !ok || len(user) == 0 {
+		respondError(w, r, errUnauthorized)
+		return
+	}
+
+	view, r, err := authorizationView(r, false)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	var req batchRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBodyBytes)).Decode(&req); err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInvalid, "bad request - JSON failed"))
+		return
+	}
+
+	lookup, err := lookupAuthorizations(r.Context(), h.Repo, view, req.TeamIDs)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	resp, err := json.Marshal(resultBatch{OK: true, AuthorizationsLookup: lookup})
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
+		return
+	}
+	log.WithContext(ctx).Debugf("resp size: %d\n", len(resp))
+
+	respond(w, resp, http.StatusOK)
+}
+
+type getAuthorizationsRequest struct {
+	TeamIDs []string `json:"teamIds"`
+	Fields  []string `json:"fields"`
+}
+
+// GetAuthorizationsRPC serves the same lookup as GetAuthorizations over RPC, fields are passed in the body.
+func GetAuthorizationsRPC(repo AuthorizationsRepository) rpc.HandlerFunc {
+	return func(ctx context.Context, body []byte) (interface{}, error) {
+		var req getAuthorizationsRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+
+		f, err := ParseAuthorizationFields(req.Fields)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx = WithAuthorizationFields(ctx, f)
+
+		return lookupAuthorizations(ctx, repo, NewAuthorizationView(ctx, f), req.TeamIDs)
+	}
+}
+
+func lookupAuthorizations(ctx context.Context, repo AuthorizationsRepository, view AuthorizationView, teamIDs []string) (*AuthorizationsLookup, error) {
+	switch {
+	case len(teamIDs) == 0:
+		return nil, errNoTeamIDs
+	case len(teamIDs) > MaxBatchTeamIDs:
+		return nil, errTooManyTeamIDs
+	}
+
+	valid, errs := checkTeamIDs(teamIDs)
+
+	batch := &AuthorizationsBatch{}
+	if len(valid) > 0 {
+		var err error
+		if batch, err = repo.GetAuthorizations(ctx, valid); err != nil {
+			return nil, errors.WithKind(err, errors.KindInternal, "DB request failed")
+		}
+	}
+	log.WithContext(ctx).Debugf("auths: %d found, %d missing, %d failed\n", len(batch.Authorizations), len(batch.Missing), len(errs))
+
+	res := &AuthorizationsLookup{
+		Auths:   view.RenderAll(batch.Authorizations),
+		Missing: batch.Missing,
+		Errors:  itemErrors(errs),
+	}
+	if res.Missing == nil {
+		res.Missing = []string{}
+	}
+
+	return res, nil
+}
+
+// checkTeamIDs returns the team IDs that can be looked up and an error for each of the others,
+// indexed by its position in teamIDs.
+func checkTeamIDs(teamIDs []string) ([]string, errors.Errors) {
+	valid := make([]string, 0, len(teamIDs))
+
+	var errs errors.Errors
+
+	for i, teamID := range teamIDs {
+		if teamID == "" {
+			errs = append(errs, errors.WithIndex(errEmptyTeamID, i))
+			continue
+		}
+
+		valid = append(valid, teamID)
+	}
+
+	return valid, errs
+}
+
+// itemErrors turns errors made by errors.WithIndex into the shape clients get.
+func itemErrors(errs errors.Errors) []itemError {
+	type indexedCauser interface {
+		Index() int
+		Cause() error
+	}
+
+	var res []itemError
+
+	for _, err := range errs {
+		ic, ok := err.(indexedCauser)
+		if !ok {
+			continue
+		}
+
+		res = append(res, itemError{
+			Index:   ic.Index(),
+			Code:    errors.KindOf(ic.Cause()),
+			Message: errors.MessageOf(ic.Cause()),
+		})
+	}
+
+	return res
+}
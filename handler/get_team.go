@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+)
+
+// GetTeam serves a single Slack team.
+//
+// Path params: teamId.
+type GetTeam struct {
+	Repo TeamsRepository
+}
+
+type resultTeam struct {
+	OK   bool           `json:"ok"`
+	Team *rpc.SlackTeam `json:"team"`
+}
+
+func (h GetTeam) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		respondError(w, r, errOnlyGET)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
+	if !ok || len(user) == 0 {
+		respondError(w, r, errUnauthorized)
+		return
+	}
+
+	teamId := teamIDParam(r)
+	if len(teamId) == 0 {
+		respondError(w, r, errNoTeamID)
+		return
+	}
+
+	team, err := h.Repo.FindTeamByID(ctx, teamId)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	resp, err := json.Marshal(resultTeam{OK: true, Team: team})
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
+		return
+	}
+
+	respond(w, resp, http.StatusOK)
+}
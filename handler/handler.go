@@ -2,32 +2,31 @@
 package handler
 
 import (
-	"net/url"
-	"bytes"
-	"fmt"
 	"net/http"
+	"net/url"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+)
 
-	log "github.com/sirupsen/logrus"
+var (
+	errOnlyGET      = errors.E(errors.KindMethodNotAllowed, "only GET requests are supported")
+	errUnauthorized = errors.E(errors.KindUnauthorized, "authorization required")
+	errNoTeamID     = errors.E(errors.KindInvalid, "bad param - no teamId")
 )
 
 func respond(w http.ResponseWriter, body []byte, code int) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(code)
-	_, err := w.Write(body)
-	if err != nil {
-		log.WithError(err).Debug("Write in respond failed")
-	}
+	response.JSON(w, body, code)
 }
 
-func isSupported(method string) bool {
-	return method == "GET"
+// respondError writes err in the error envelope shared by all endpoints.
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	response.Error(w, r, err)
 }
 
-func errorJSON(msg string) []byte {
-	buf := bytes.Buffer{}
-	fmt.Fprintf(&buf, `{"error": "%s"}`, msg)
-	return buf.Bytes()
+func isSupported(method string) bool {
+	return method == "GET"
 }
 
 type request struct {
@@ -35,9 +34,10 @@ type request struct {
 	authRole AuthRole
 }
 
-type AuthRole string
+// AuthRole is kept for code that predates auth.Role.
+type AuthRole = auth.Role
 
 const (
-	RoleBot    AuthRole = "standuply-bot"
-	RoleMeteor AuthRole = "meteor"
+	RoleBot    = auth.RoleBot
+	RoleMeteor = auth.RoleMeteor
 )
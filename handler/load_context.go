@@ -4,19 +4,30 @@ import (
 	"context"
 	"net/http"
 
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
 	"bitbucket.org/iwlab-standuply/slackteams-api/shared"
 )
 
-type CtxKey string
+type CtxKey = response.CtxKey
 
 const (
-	CtxKeyRequestID CtxKey = "requestId"
+	CtxKeyRequestID = response.CtxKeyRequestID
 )
 
+// maxRequestIDLength bounds request IDs of clients, so they cannot bloat logs.
+const maxRequestIDLength = 128
+
+// LoadContextMiddleware gives the request an ID and echoes it in X-Request-ID. A request ID
+// a client or proxy sent in X-Request-ID is kept, so a request can be followed across services.
 func LoadContextMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			requestID := shared.RandStringBytesMaskImprSrcUnsafe(24)
+			requestID := r.Header.Get(response.RequestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = shared.RandStringBytesMaskImprSrcUnsafe(24)
+			}
+
+			w.Header().Set(response.RequestIDHeader, requestID)
 
 			r = r.WithContext(
 				context.WithValue(
@@ -30,3 +41,21 @@ func LoadContextMiddleware() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// validRequestID accepts IDs of common generators, like UUIDs, and nothing that could forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '/' || c == '+' || c == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"net/http"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/router"
+)
+
+// teamIDParam reads the team ID from the route path, or from the query on legacy routes.
+func teamIDParam(r *http.Request) string {
+	if teamId := router.Param(r, "teamId"); teamId != "" {
+		return teamId
+	}
+
+	return r.URL.Query().Get("teamId")
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// SearchTeams looks teams up by name, domain or email domain prefix.
+//
+// Query params: q, name, domain, emailDomain, isDeleted, tag (repeatable), limit, offset.
+type SearchTeams struct {
+	Repo TeamsRepository
+}
+
+type searchTeamsResult struct {
+	OK bool `json:"ok"`
+	*rpc.TeamSearchResult
+}
+
+func (h SearchTeams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		respondError(w, r, errOnlyGET)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
+	if !ok || len(user) == 0 {
+		respondError(w, r, errUnauthorized)
+		return
+	}
+
+	query, err := parseTeamSearchQuery(r)
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInvalid, "bad param - "+err.Error()))
+		return
+	}
+
+	teams, err := h.Repo.SearchTeams(ctx, query)
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "DB request failed"))
+		return
+	}
+	log.WithContext(ctx).Debugf("search teams: %d of %d\n", len(teams.Teams), teams.Total)
+
+	resp, err := json.Marshal(searchTeamsResult{OK: true, TeamSearchResult: teams})
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
+		return
+	}
+
+	respond(w, resp, http.StatusOK)
+}
+
+func parseTeamSearchQuery(r *http.Request) (rpc.TeamSearchQuery, error) {
+	v := r.URL.Query()
+
+	q := rpc.TeamSearchQuery{
+		Query:       v.Get("q"),
+		Name:        v.Get("name"),
+		Domain:      v.Get("domain"),
+		EmailDomain: v.Get("emailDomain"),
+		Tags:        v["tag"],
+	}
+
+	if s := v.Get("isDeleted"); s != "" {
+		isDeleted, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, err
+		}
+		q.IsDeleted = &isDeleted
+	}
+
+	for name, dst := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+		if s := v.Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return q, err
+			}
+			*dst = n
+		}
+	}
+
+	return q.Normalize(), nil
+}
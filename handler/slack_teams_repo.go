@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"context"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+)
+
+type TeamsRepository interface {
+	FindTeamByID(ctx context.Context, teamID string) (*rpc.SlackTeam, error)
+	SearchTeams(ctx context.Context, query rpc.TeamSearchQuery) (*rpc.TeamSearchResult, error)
+}
@@ -5,4 +5,14 @@ import "context"
 type AuthorizationsRepository interface {
 	GetAllAuthorizations(ctx context.Context) ([]*SlackBotAuthorization, error)
 	GetAuthorization(ctx context.Context, teamId string) (*SlackBotAuthorization, error)
+	// GetAuthorizations looks many teams up at once, teams without an enabled authorization
+	// are listed as missing rather than failing the lookup.
+	GetAuthorizations(ctx context.Context, teamIDs []string) (*AuthorizationsBatch, error)
+}
+
+// AuthorizationsBatch is the result of a bulk lookup. Both lists follow the order of the
+// requested team IDs, a team requested twice is listed once.
+type AuthorizationsBatch struct {
+	Authorizations []*SlackBotAuthorization
+	Missing        []string
 }
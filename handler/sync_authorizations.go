@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+)
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 1000
+)
+
+var (
+	ErrInvalidCursor = errors.E(errors.KindInvalid, "invalid sync cursor")
+	// ErrCursorExpired means changes since the cursor are no longer kept,
+	// the client has to fetch all authorizations again.
+	ErrCursorExpired = errors.E(errors.KindGone, "sync cursor expired")
+)
+
+type AuthorizationChangeKind string
+
+const (
+	ChangeAdded        AuthorizationChangeKind = "added"
+	ChangeUpdated      AuthorizationChangeKind = "updated"
+	ChangeDisabled     AuthorizationChangeKind = "disabled"
+	ChangeRemoved      AuthorizationChangeKind = "removed"
+	ChangeTokenRotated AuthorizationChangeKind = "token_rotated"
+)
+
+type AuthorizationChange struct {
+	Kind   AuthorizationChangeKind `json:"kind"`
+	ID     string                  `json:"id"`
+	TeamId string                  `json:"teamId"`
+	At     time.Time               `json:"at"`
+	// Cursor points right after this change.
+	Cursor string `json:"cursor"`
+	// Auth is the current state of the authorization. It is set for changes
+	// of authorizations that are still enabled.
+	Auth *SlackBotAuthorization `json:"auth,omitempty"`
+}
+
+type AuthorizationsDelta struct {
+	Changes []AuthorizationChange `json:"changes"`
+	// Cursor is passed to the next call to get changes that follow these.
+	Cursor string `json:"cursor"`
+	// HasMore tells there are more changes after Cursor right away.
+	HasMore bool `json:"hasMore"`
+}
+
+type AuthorizationsSyncRepository interface {
+	// AuthorizationsSince returns changes after cursor in the order they happened.
+	// An empty cursor returns no changes and the cursor of the current moment.
+	AuthorizationsSince(ctx context.Context, cursor string, limit int) (*AuthorizationsDelta, error)
+	// LastModified is when authorizations last changed, including removals and changes the journal lost.
+	// It is zero when that is not known, like after a quiet retention period.
+	LastModified(ctx context.Context) (time.Time, error)
+}
+
+// SyncAuthorizations serves changes of authorizations since a cursor, so clients can
+// keep a mirror of them. A client gets a cursor first, then fetches all authorizations
+// and then polls for changes since the cursor.
+//
+// Query params: cursor, limit.
+type SyncAuthorizations struct {
+	Repo AuthorizationsSyncRepository
+}
+
+type resultSync struct {
+	OK bool `json:"ok"`
+	*AuthorizationsDelta
+}
+
+func (h SyncAuthorizations) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		respondError(w, r, errOnlyGET)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, ok := ctx.Value(auth.CtxKeyAuthUser).(string)
+	if !ok || len(user) == 0 {
+		respondError(w, r, errUnauthorized)
+		return
+	}
+
+	v := r.URL.Query()
+
+	limit := 0
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			respondError(w, r, errors.WithKind(err, errors.KindInvalid, "bad param - limit"))
+			return
+		}
+		limit = n
+	}
+
+	delta, err := h.Repo.AuthorizationsSince(ctx, v.Get("cursor"), syncLimit(limit))
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	resp, err := json.Marshal(resultSync{OK: true, AuthorizationsDelta: delta})
+	if err != nil {
+		respondError(w, r, errors.WithKind(err, errors.KindInternal, "JSON failed"))
+		return
+	}
+
+	respond(w, resp, http.StatusOK)
+}
+
+type syncAuthorizationsRequest struct {
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+// SyncAuthorizationsRPC serves the same changes as SyncAuthorizations over RPC.
+func SyncAuthorizationsRPC(repo AuthorizationsSyncRepository) rpc.HandlerFunc {
+	return func(ctx context.Context, body []byte) (interface{}, error) {
+		var req syncAuthorizationsRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+
+		return repo.AuthorizationsSince(ctx, req.Cursor, syncLimit(req.Limit))
+	}
+}
+
+func syncLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return defaultSyncLimit
+	case limit > maxSyncLimit:
+		return maxSyncLimit
+	}
+
+	return limit
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/icon"
+	log "github.com/sirupsen/logrus"
+)
+
+type IconService interface {
+	TeamIcon(ctx context.Context, teamID string, size int, format icon.Format) (*icon.Icon, error)
+}
+
+// TeamIcon serves a team icon resized to the requested size.
+// It does not require authorization as icons are loaded by browsers in <img> tags.
+//
+// Path params: teamId, or a query param on the legacy route.
+// Query params: size (pixels, defaults to 132), format (png or jpeg, defaults to the Accept header).
+type TeamIcon struct {
+	Icons IconService
+}
+
+func (h TeamIcon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		respondError(w, r, errOnlyGET)
+		return
+	}
+
+	ctx := r.Context()
+	v := r.URL.Query()
+
+	teamId := teamIDParam(r)
+	if len(teamId) == 0 {
+		respondError(w, r, errNoTeamID)
+		return
+	}
+
+	size := 132
+	if s := v.Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			respondError(w, r, errors.WithKind(err, errors.KindInvalid, "bad param - size"))
+			return
+		}
+		size = n
+	}
+
+	format, err := iconFormat(v.Get("format"), r.Header.Get("Accept"))
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	img, err := h.Icons.TeamIcon(ctx, teamId, size, format)
+	if err != nil {
+		// Failures other than bad params and unknown teams come from fetching the source image.
+		if errors.KindOf(err) == errors.KindInternal {
+			err = errors.WithKind(err, errors.KindUnavailable, "icon source unavailable")
+		}
+
+		respondError(w, r, err)
+		return
+	}
+
+	serveIcon(w, r, img)
+}
+
+// iconFormat prefers an explicit format and falls back to the first supported type in Accept.
+func iconFormat(format string, accept string) (icon.Format, error) {
+	if format != "" {
+		return icon.ParseFormat(format)
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if f, err := icon.ParseFormat(mediaType); err == nil && mediaType != "" {
+			return f, nil
+		}
+	}
+
+	return icon.FormatPNG, nil
+}
+
+func serveIcon(w http.ResponseWriter, r *http.Request, img *icon.Icon) {
+	w.Header().Set("ETag", img.ETag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Vary", "Accept")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && match == img.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.Data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == "HEAD" {
+		return
+	}
+
+	if _, err := w.Write(img.Data); err != nil {
+		log.WithError(err).Debug("Write in serveIcon failed")
+	}
+}
@@ -0,0 +1,151 @@
+// Package health reports whether the service is alive and whether it can reach what it depends on.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+var errOnlyGET = errors.E(errors.KindMethodNotAllowed, "only GET is allowed")
+
+// Check is a dependency the service needs to serve requests.
+type Check struct {
+	Name string
+	// Timeout bounds Run, a dependency that is slower than that is not ready.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+type Report struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyReport `json:"dependencies,omitempty"`
+}
+
+type DependencyReport struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Liveness answers as long as the process serves HTTP.
+func Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			response.Error(w, r, errOnlyGET)
+			return
+		}
+
+		write(w, Report{Status: StatusOK})
+	})
+}
+
+// Readiness runs checks in parallel and answers 503 unless all of them pass.
+func Readiness(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			response.Error(w, r, errOnlyGET)
+			return
+		}
+
+		report := Run(r.Context(), checks...)
+		if report.Status != StatusOK {
+			log.WithContext(r.Context()).WithField("report", report).Warn("Not ready")
+		}
+
+		write(w, report)
+	})
+}
+
+// Run runs checks in parallel, each with its own timeout.
+func Run(ctx context.Context, checks ...Check) Report {
+	report := Report{
+		Status:       StatusOK,
+		Dependencies: make(map[string]DependencyReport, len(checks)),
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	for _, c := range checks {
+		wg.Add(1)
+
+		go func(c Check) {
+			defer wg.Done()
+
+			dep := run(ctx, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Dependencies[c.Name] = dep
+			if dep.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(c)
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+func run(ctx context.Context, c Check) DependencyReport {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// A check that ignores ctx still gives up after its timeout.
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	dep := DependencyReport{
+		Status:   StatusOK,
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+	}
+
+	if err != nil {
+		dep.Status = StatusFail
+		dep.Error = err.Error()
+	}
+
+	return dep
+}
+
+func write(w http.ResponseWriter, report Report) {
+	code := http.StatusOK
+	if report.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode health report")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, body, code)
+}
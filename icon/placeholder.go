@@ -0,0 +1,222 @@
+package icon
+
+import (
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+	"unicode"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// placeholderMasterSize is the size placeholders are drawn at before being scaled down,
+// drawing big and resizing gives smoother letters than drawing at small sizes.
+const placeholderMasterSize = 512
+
+// placeholderColors are backgrounds readable with white text.
+var placeholderColors = []color.RGBA{
+	{0xE0, 0x1E, 0x5A, 0xFF},
+	{0x36, 0xC5, 0xF0, 0xFF},
+	{0x2E, 0xB6, 0x7D, 0xFF},
+	{0xEC, 0xB2, 0x2E, 0xFF},
+	{0x4A, 0x15, 0x4B, 0xFF},
+	{0x1D, 0x9B, 0xD1, 0xFF},
+	{0x7C, 0x3A, 0xED, 0xFF},
+	{0xDB, 0x27, 0x77, 0xFF},
+	{0x05, 0x96, 0x69, 0xFF},
+	{0xD9, 0x77, 0x06, 0xFF},
+}
+
+var (
+	placeholderFontParsed *sfnt.Font
+	placeholderFontErr    error
+	placeholderFontOnce   sync.Once
+)
+
+// HasCustomIcon reports whether a team uploaded its own icon to Slack.
+func HasCustomIcon(icon rpc.SlackIcon) bool {
+	return !icon.ImageDefault && BestSource(icon, 0) != ""
+}
+
+// Initials returns up to two letters naming the team: first letters of the
+// first two words of name, or the first two letters of a single word.
+func Initials(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var res []rune
+
+	switch len(words) {
+	case 0:
+		return "?"
+	case 1:
+		res = []rune(words[0])
+		if len(res) > 2 {
+			res = res[:2]
+		}
+	default:
+		res = []rune{[]rune(words[0])[0], []rune(words[1])[0]}
+	}
+
+	return strings.ToUpper(string(res))
+}
+
+// PlaceholderColor derives a stable background color from the team ID.
+func PlaceholderColor(teamID string) color.RGBA {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(teamID))
+
+	return placeholderColors[h.Sum32()%uint32(len(placeholderColors))]
+}
+
+// Placeholder draws the team initials on a colored square of size x size pixels.
+func Placeholder(team *rpc.SlackTeam, size int) (image.Image, error) {
+	img := image.NewRGBA(image.Rect(0, 0, placeholderMasterSize, placeholderMasterSize))
+	draw.Draw(img, img.Bounds(), &image.Uniform{PlaceholderColor(team.ID)}, image.Point{}, draw.Src)
+
+	segments, bounds, err := textOutline(Initials(team.Name), fixed.I(placeholderMasterSize*2/5))
+	if err != nil {
+		return nil, err
+	}
+
+	// Center the outline by its own bounds rather than the font metrics,
+	// so the letters are optically centered regardless of ascenders and descenders.
+	dx := (float32(placeholderMasterSize)-(bounds.Max.X-bounds.Min.X))/2 - bounds.Min.X
+	dy := (float32(placeholderMasterSize)-(bounds.Max.Y-bounds.Min.Y))/2 - bounds.Min.Y
+
+	z := vector.NewRasterizer(placeholderMasterSize, placeholderMasterSize)
+	for _, seg := range segments {
+		p := func(i int) (float32, float32) {
+			return float32(seg.Args[i].X)/64 + dx, float32(seg.Args[i].Y)/64 + dy
+		}
+
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			z.MoveTo(p(0))
+		case sfnt.SegmentOpLineTo:
+			z.LineTo(p(0))
+		case sfnt.SegmentOpQuadTo:
+			x1, y1 := p(0)
+			x2, y2 := p(1)
+			z.QuadTo(x1, y1, x2, y2)
+		case sfnt.SegmentOpCubeTo:
+			x1, y1 := p(0)
+			x2, y2 := p(1)
+			x3, y3 := p(2)
+			z.CubeTo(x1, y1, x2, y2, x3, y3)
+		}
+	}
+	z.Draw(img, img.Bounds(), image.White, image.Point{})
+
+	return Resize(img, size), nil
+}
+
+type outlineBounds struct {
+	Min, Max struct{ X, Y float32 }
+}
+
+// textOutline lays text out on a single line and returns the outlines of its glyphs
+// with the bounds of all their points, in pixels.
+func textOutline(text string, ppem fixed.Int26_6) ([]sfnt.Segment, outlineBounds, error) {
+	var bounds outlineBounds
+
+	f, err := placeholderFont()
+	if err != nil {
+		return nil, bounds, err
+	}
+
+	var (
+		buf      sfnt.Buffer
+		res      []sfnt.Segment
+		x        fixed.Int26_6
+		hasPoint bool
+	)
+
+	for _, r := range text {
+		idx, err := f.GlyphIndex(&buf, r)
+		if err != nil {
+			return nil, bounds, err
+		}
+
+		segments, err := f.LoadGlyph(&buf, idx, ppem, nil)
+		if err != nil {
+			return nil, bounds, err
+		}
+
+		for _, seg := range segments {
+			n := map[sfnt.SegmentOp]int{sfnt.SegmentOpQuadTo: 2, sfnt.SegmentOpCubeTo: 3}[seg.Op]
+			if n == 0 {
+				n = 1
+			}
+
+			for i := 0; i < n; i++ {
+				seg.Args[i].X += x
+
+				px, py := float32(seg.Args[i].X)/64, float32(seg.Args[i].Y)/64
+				if !hasPoint || px < bounds.Min.X {
+					bounds.Min.X = px
+				}
+				if !hasPoint || py < bounds.Min.Y {
+					bounds.Min.Y = py
+				}
+				if !hasPoint || px > bounds.Max.X {
+					bounds.Max.X = px
+				}
+				if !hasPoint || py > bounds.Max.Y {
+					bounds.Max.Y = py
+				}
+				hasPoint = true
+			}
+
+			res = append(res, seg)
+		}
+
+		advance, err := f.GlyphAdvance(&buf, idx, ppem, font.HintingNone)
+		if err != nil {
+			return nil, bounds, err
+		}
+		x += advance
+	}
+
+	return res, bounds, nil
+}
+
+func (s *Service) placeholderIcon(team *rpc.SlackTeam, size int, format Format) (*Icon, error) {
+	// The name is a part of the key so a renamed team gets new initials.
+	key := cacheKey("placeholder:"+team.ID+":"+team.Name, size, format)
+
+	v, err, _ := s.group.Do(key, func() (interface{}, error) {
+		if icon, err := s.readCached(key, format); err == nil {
+			return icon, nil
+		}
+
+		img, err := Placeholder(team, size)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.encodeAndStore(key, img, format)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Icon), nil
+}
+
+func placeholderFont() (*sfnt.Font, error) {
+	placeholderFontOnce.Do(func() {
+		placeholderFontParsed, placeholderFontErr = sfnt.Parse(gobold.TTF)
+	})
+
+	return placeholderFontParsed, placeholderFontErr
+}
@@ -0,0 +1,421 @@
+// Package icon serves team icons in any size, resized from the images Slack stores for a team.
+package icon
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif" // Register decoders of the formats Slack serves icons in.
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/anthonynsimon/bild/transform"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	MinSize = 16
+
+	// maxSourceBytes limits how much of a source image is downloaded.
+	maxSourceBytes = 5 << 20
+	// maxSourcePixels limits what a source image decodes to, small files can hold huge images.
+	maxSourcePixels = 2048 * 2048
+	// fetchTimeout bounds a fetch shared by the callers waiting for the same icon.
+	fetchTimeout = 20 * time.Second
+)
+
+var (
+	ErrInvalidSize       = errors.E(errors.KindInvalid, "invalid icon size")
+	ErrUnsupportedFormat = errors.E(errors.KindInvalid, "unsupported icon format")
+	errSourceTooLarge    = errors.E(errors.KindUnavailable, "icon source image is too large")
+)
+
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+)
+
+var contentTypes = map[Format]string{
+	FormatPNG:  "image/png",
+	FormatJPEG: "image/jpeg",
+	FormatWebP: "image/webp",
+}
+
+// encoders of formats this build can serve, WebP is added by cgo builds.
+var encoders = map[Format]imgio.Encoder{
+	FormatPNG:  imgio.PNGEncoder(),
+	FormatJPEG: imgio.JPEGEncoder(90),
+}
+
+// ParseFormat accepts format names as they come in URLs and Accept headers.
+// Formats this build cannot encode are unsupported.
+func ParseFormat(s string) (Format, error) {
+	var format Format
+
+	switch s {
+	case "", "png", "image/png":
+		format = FormatPNG
+	case "jpeg", "jpg", "image/jpeg":
+		format = FormatJPEG
+	case "webp", "image/webp":
+		format = FormatWebP
+	}
+
+	if _, ok := encoders[format]; !ok {
+		return "", ErrUnsupportedFormat
+	}
+
+	return format, nil
+}
+
+// Icon is an encoded image ready to be served.
+type Icon struct {
+	Data        []byte
+	ContentType string
+	// ETag is a hash of Data.
+	ETag    string
+	ModTime time.Time
+}
+
+type TeamsRepository interface {
+	FindTeamByID(ctx context.Context, teamID string) (*rpc.SlackTeam, error)
+}
+
+type Config struct {
+	Teams TeamsRepository
+	// CacheDir keeps resized icons between restarts.
+	CacheDir string
+	// CacheMaxAge and CacheMaxBytes bound the disk cache, Prune removes older icons
+	// and then the oldest ones until the rest fits. Zero leaves a bound out.
+	CacheMaxAge   time.Duration
+	CacheMaxBytes int64
+	MaxSize       int
+	Client        *http.Client
+}
+
+// Service resizes team icons and caches the results on disk.
+type Service struct {
+	teams         TeamsRepository
+	cacheDir      string
+	cacheMaxAge   time.Duration
+	cacheMaxBytes int64
+	maxSize       int
+	client        *http.Client
+	group         singleflight.Group
+}
+
+func NewService(conf Config) (*Service, error) {
+	if err := os.MkdirAll(conf.CacheDir, 0755); err != nil {
+		return nil, err
+	}
+
+	client := conf.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Service{
+		teams:         conf.Teams,
+		cacheDir:      conf.CacheDir,
+		cacheMaxAge:   conf.CacheMaxAge,
+		cacheMaxBytes: conf.CacheMaxBytes,
+		maxSize:       conf.MaxSize,
+		client:        client,
+	}, nil
+}
+
+// TeamIcon returns the icon of a team resized to size x size pixels.
+// Teams without a custom icon get a generated placeholder.
+func (s *Service) TeamIcon(ctx context.Context, teamID string, size int, format Format) (*Icon, error) {
+	if size < MinSize || size > s.maxSize {
+		return nil, ErrInvalidSize
+	}
+
+	if _, ok := encoders[format]; !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	team, err := s.teams.FindTeamByID(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !HasCustomIcon(team.Icon) {
+		return s.placeholderIcon(team, size, format)
+	}
+
+	source := BestSource(team.Icon, size)
+	key := cacheKey(source, size, format)
+
+	// The fetch is shared, so it must not fail when the caller that started it goes away.
+	ch := s.group.DoChan(key, func() (interface{}, error) {
+		if icon, err := s.readCached(key, format); err == nil {
+			return icon, nil
+		}
+
+		fetchCtx, cancel := context.WithTimeout(detached{ctx}, fetchTimeout)
+		defer cancel()
+
+		img, err := s.fetch(fetchCtx, source)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.encodeAndStore(key, Resize(img, size), format)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*Icon), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// BestSource picks the smallest stored image not smaller than size, or the largest one.
+func BestSource(icon rpc.SlackIcon, size int) string {
+	sources := []struct {
+		size int
+		url  string
+	}{
+		{34, icon.Image34},
+		{44, icon.Image44},
+		{68, icon.Image68},
+		{88, icon.Image88},
+		{102, icon.Image102},
+		{132, icon.Image132},
+		{230, icon.Image230},
+	}
+
+	largest := ""
+
+	for _, src := range sources {
+		if src.url == "" {
+			continue
+		}
+		if src.size >= size {
+			return src.url
+		}
+		largest = src.url
+	}
+
+	return largest
+}
+
+// Resize scales img into a size x size square.
+func Resize(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	if b.Dx() == size && b.Dy() == size {
+		return img
+	}
+
+	return transform.Resize(img, size, size, transform.Lanczos)
+}
+
+// Encode writes img in format and wraps it into an Icon.
+func Encode(img image.Image, format Format) (*Icon, error) {
+	encode, ok := encoders[format]
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return newIcon(buf.Bytes(), format, time.Now()), nil
+}
+
+func (s *Service) fetch(ctx context.Context, url string) (image.Image, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch icon %s: status %d", url, resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSourceBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the dimensions before decoding, pixels are what take memory.
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode icon %s: %w", url, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxSourcePixels {
+		return nil, errors.WithKind(fmt.Errorf("icon %s is %dx%d", url, cfg.Width, cfg.Height), errors.KindUnavailable, errors.MessageOf(errSourceTooLarge))
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode icon %s: %w", url, err)
+	}
+
+	return img, nil
+}
+
+func (s *Service) readCached(key string, format Format) (*Icon, error) {
+	path := s.cachePath(key, format)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newIcon(data, format, info.ModTime()), nil
+}
+
+func (s *Service) encodeAndStore(key string, img image.Image, format Format) (*Icon, error) {
+	icon, err := Encode(img, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write to a temporary file first so readers never see a partial icon.
+	path := s.cachePath(key, format)
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, icon.Data, 0644); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+
+	return icon, nil
+}
+
+// RunPruner prunes the disk cache every interval until ctx is done.
+func (s *Service) RunPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Prune(time.Now()); err != nil {
+			log.WithError(err).Error("Failed to prune icon cache")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune removes cached icons older than the max age, then the oldest ones until the cache
+// fits the max size. Icons are made again when requested.
+func (s *Service) Prune(now time.Time) error {
+	infos, err := ioutil.ReadDir(s.cacheDir)
+	if err != nil {
+		return err
+	}
+
+	// Oldest first.
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	var total int64
+	for _, info := range infos {
+		total += info.Size()
+	}
+
+	removed := 0
+
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+
+		expired := s.cacheMaxAge > 0 && now.Sub(info.ModTime()) > s.cacheMaxAge
+		tooBig := s.cacheMaxBytes > 0 && total > s.cacheMaxBytes
+		// Temporary files left by a crash, writes take far less than an hour.
+		stale := strings.HasSuffix(info.Name(), ".tmp") && now.Sub(info.ModTime()) > time.Hour
+
+		if !expired && !tooBig && !stale {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(s.cacheDir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		total -= info.Size()
+		removed++
+	}
+
+	if removed > 0 {
+		log.WithFields(log.Fields{"removed": removed, "bytes": total}).Info("Pruned icon cache")
+	}
+
+	return nil
+}
+
+func (s *Service) cachePath(key string, format Format) string {
+	return filepath.Join(s.cacheDir, key+"."+string(format))
+}
+
+func cacheKey(source string, size int, format Format) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", source, size, format)))
+	return hex.EncodeToString(sum[:])
+}
+
+func newIcon(data []byte, format Format, modTime time.Time) *Icon {
+	sum := sha256.Sum256(data)
+
+	return &Icon{
+		Data:        data,
+		ContentType: contentTypes[format],
+		ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		ModTime:     modTime,
+	}
+}
+
+// detached is a context with the values of its parent but not its deadline or cancellation.
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (d detached) Done() <-chan struct{}             { return nil }
+func (d detached) Err() error                        { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
@@ -0,0 +1,71 @@
+package icon
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	"bitbucket.org/iwlab-standuply/slackteams-api/shared"
+)
+
+type placeholderTeamsRepository struct {
+	repo    rpc.SlackTeamsRepository
+	baseURL string
+}
+
+// NewPlaceholderTeamsRepository points icons of teams without a custom icon
+// at generated placeholders served by the API at baseURL.
+func NewPlaceholderTeamsRepository(repo rpc.SlackTeamsRepository, baseURL string) rpc.SlackTeamsRepository {
+	return &placeholderTeamsRepository{
+		repo:    repo,
+		baseURL: baseURL,
+	}
+}
+
+func (r *placeholderTeamsRepository) FindTeamByID(ctx context.Context, teamID string) (*rpc.SlackTeam, error) {
+	team, err := r.repo.FindTeamByID(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.withPlaceholder(team), nil
+}
+
+func (r *placeholderTeamsRepository) SearchTeams(ctx context.Context, query rpc.TeamSearchQuery) (*rpc.TeamSearchResult, error) {
+	res, err := r.repo.SearchTeams(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, team := range res.Teams {
+		res.Teams[i] = r.withPlaceholder(team)
+	}
+
+	return res, nil
+}
+
+// withPlaceholder returns a copy of team, teams may be shared with a cache and must not be modified.
+func (r *placeholderTeamsRepository) withPlaceholder(team *rpc.SlackTeam) *rpc.SlackTeam {
+	if HasCustomIcon(team.Icon) {
+		return team
+	}
+
+	res := *team
+	res.Icon = rpc.SlackIcon{
+		Image34:      r.url(team.ID, 34),
+		Image44:      r.url(team.ID, 44),
+		Image68:      r.url(team.ID, 68),
+		Image88:      r.url(team.ID, 88),
+		Image102:     r.url(team.ID, 102),
+		Image132:     r.url(team.ID, 132),
+		Image230:     r.url(team.ID, 230),
+		ImageDefault: true,
+	}
+
+	return &res
+}
+
+func (r *placeholderTeamsRepository) url(teamID string, size int) string {
+	return shared.FormatURL(r.baseURL, "v1", "teams", url.PathEscape(teamID), "icon") + "?size=" + strconv.Itoa(size)
+}
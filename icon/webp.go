@@ -0,0 +1,23 @@
+//go:build cgo
+// +build cgo
+
+package icon
+
+import (
+	"image"
+	"io"
+
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/chai2010/webp"
+)
+
+func init() {
+	encoders[FormatWebP] = webpEncoder(90)
+}
+
+// webpEncoder encodes lossy WebP, the encoder of libwebp needs cgo.
+func webpEncoder(quality float32) imgio.Encoder {
+	return func(w io.Writer, img image.Image) error {
+		return webp.Encode(w, img, &webp.Options{Quality: quality})
+	}
+}
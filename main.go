@@ -2,38 +2,154 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
 	"net/http"
 	"os"
 	"os/signal"
 	"time"
 
+	"bitbucket.org/iwlab-standuply/slackteams-api/accesslog"
+	"bitbucket.org/iwlab-standuply/slackteams-api/activity"
 	"bitbucket.org/iwlab-standuply/slackteams-api/amqp"
+	"bitbucket.org/iwlab-standuply/slackteams-api/cache"
+	"bitbucket.org/iwlab-standuply/slackteams-api/certs"
+	"bitbucket.org/iwlab-standuply/slackteams-api/dashboard"
 	"bitbucket.org/iwlab-standuply/slackteams-api/database"
 	"bitbucket.org/iwlab-standuply/slackteams-api/database/mongodb"
+	"bitbucket.org/iwlab-standuply/slackteams-api/graph"
+	"bitbucket.org/iwlab-standuply/slackteams-api/health"
+	"bitbucket.org/iwlab-standuply/slackteams-api/metrics"
+	"bitbucket.org/iwlab-standuply/slackteams-api/ratelimit"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	"bitbucket.org/iwlab-standuply/slackteams-api/router"
 	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	"bitbucket.org/iwlab-standuply/slackteams-api/slack"
+	"bitbucket.org/iwlab-standuply/slackteams-api/sse"
 
 	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
 	"bitbucket.org/iwlab-standuply/slackteams-api/config"
+	"bitbucket.org/iwlab-standuply/slackteams-api/cors"
 	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+	"bitbucket.org/iwlab-standuply/slackteams-api/icon"
 	"bitbucket.org/iwlab-standuply/slackteams-api/logger"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func CorsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+// newCORS makes the middleware applying CORS policies, routes are told by route.
+func newCORS(conf config.CORSConfig, route func(path string) string) router.Middleware {
+	routes, err := conf.ParseRoutes()
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to load CORS policies`)
+	}
 
-		if r.Method == "OPTIONS" {
-			w.Header().Set("Access-Control-Allow-Headers", "Cookie, Content-Type, X-Auth-Token, X-Language, Authorization")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.WriteHeader(200)
-			return
+	policy := cors.Policy{
+		Origins:        config.SplitList(conf.Origins),
+		Methods:        config.SplitList(conf.Methods),
+		Headers:        config.SplitList(conf.Headers),
+		ExposedHeaders: config.SplitList(conf.ExposedHeaders),
+		Credentials:    conf.Credentials,
+		MaxAge:         time.Duration(conf.MaxAge) * time.Second,
+	}
+
+	if err := policy.Validate(); err != nil {
+		log.WithError(err).Fatal(`Failed to load CORS policies`)
+	}
+
+	corsConf := cors.Config{
+		Default: policy,
+		Routes:  map[string]cors.Policy{},
+		Route:   route,
+	}
+	for _, r := range routes {
+		p := policy
+		p.Origins = r.Origins
+		if err := p.Validate(); err != nil {
+			log.WithError(err).Fatal(`Failed to load CORS policies`)
 		}
-		next.ServeHTTP(w, r)
+		corsConf.Routes[r.Route] = p
+	}
+
+	return cors.New(corsConf).Middleware
+}
+
+// newTLSConfig serves the certificate of conf, reloading it until ctx is done, and verifies client
+// certificates when conf has client CAs.
+func newTLSConfig(ctx context.Context, conf config.TLSConfig) *tls.Config {
+	reloader, err := certs.NewReloader(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to load TLS certificate`)
+	}
+	go reloader.Run(ctx, time.Duration(conf.ReloadInterval)*time.Second)
+
+	var clientCAs *x509.CertPool
+	if conf.ClientCAFile != "" {
+		if clientCAs, err = certs.LoadCAs(conf.ClientCAFile); err != nil {
+			log.WithError(err).Fatal(`Failed to load TLS client CAs`)
+		}
+	}
+
+	return certs.ServerConfig(reloader, clientCAs, conf.RequireClientCert)
+}
+
+// newInstaller serves the Slack install flow of conf, storing installs with repo and publishing events with events.
+func newInstaller(conf config.SlackConfig, repo slack.Repository, events slack.Publisher) *slack.Installer {
+	return slack.NewInstaller(slack.InstallerConfig{
+		Client:         slack.NewClient(conf.APIURL),
+		ClientID:       conf.ClientID,
+		ClientSecret:   conf.ClientSecret,
+		AuthorizeURL:   conf.AuthorizeURL,
+		Scopes:         config.SplitList(conf.Scopes),
+		UserScopes:     config.SplitList(conf.UserScopes),
+		RedirectURL:    conf.RedirectURL,
+		States:         slack.NewStates(conf.StateSecret, time.Duration(conf.StateTTL)*time.Second),
+		Repo:           repo,
+		Events:         events,
+		EventsExchange: conf.EventsExchange,
+		SuccessURL:     conf.SuccessURL,
+
+		BotTokenAsAccessToken: conf.BotTokenAsAccessToken,
 	})
 }
 
+// newAccessLog makes the middleware logging requests, it lets everything through when the log is disabled.
+func newAccessLog(conf config.AccessLogConfig) router.Middleware {
+	if !conf.Enabled {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	return accesslog.New(accesslog.Config{
+		Skip: config.SplitList(conf.Skip),
+	}).Middleware
+}
+
+// newRateLimiter makes the middleware limiting routes, it lets everything through when rate limiting is disabled.
+func newRateLimiter(conf config.RateLimitConfig, store ratelimit.Store) router.Middleware {
+	if !conf.Enabled {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	routes, err := conf.ParseRoutes()
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to load rate limits`)
+	}
+
+	limiterConf := ratelimit.Config{
+		Store:      store,
+		Default:    ratelimit.Limit{Rate: float64(conf.PerMinute) / 60, Burst: conf.Burst},
+		Routes:     map[string]ratelimit.Limit{},
+		DailyQuota: conf.DailyQuota,
+	}
+
+	for _, r := range routes {
+		limiterConf.Routes[r.Route] = ratelimit.Limit{Rate: float64(r.PerMinute) / 60, Burst: r.Burst}
+	}
+
+	return ratelimit.New(limiterConf).Middleware
+}
+
 func main() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
@@ -46,59 +162,176 @@ func main() {
 		log.WithError(err).Fatal(`Failed to load config`)
 	}
 
-	// Run AMQP RPC server
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		runMigrate(conf, args[1:])
+		return
+	}
+
+	migrateOnStart(conf)
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+
+	// Connect repositories
+
+	resolver, err := handler.NewDuplicatesResolver(
+		config.SplitList(conf.Authorizations.DuplicateRules),
+		config.SplitList(conf.Authorizations.RequiredScopes),
+	)
+
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to init DuplicatesResolver`)
+	}
 
-	amqpClient := amqp.NewClient(conf.Amqp.URI)
 	teamsRepo := mongodb.NewSlackTeamsRepository(conf.MongoDB.URI)
+	authRepo := mongodb.NewSlackBotAuthorizationsRepository(conf.MongoDB.URI, resolver)
 
-	rpcServer := rpc.NewTeamsRPCServer(amqpClient, teamsRepo)
+	journal := mongodb.NewAuthorizationJournal(conf.MongoDB.URI, time.Duration(conf.Authorizations.JournalRetention)*time.Second)
 
-	if err := rpcServer.Run(); err != nil {
-		log.WithError(err).Fatal("Failed to start RpcServer")
+	var rateLimitStore ratelimit.Store
+
+	switch conf.RateLimit.Store {
+	case "memory":
+		rateLimitStore = ratelimit.NewMemoryStore()
+	case "mongo":
+		rateLimitStore = mongodb.NewRateLimitStore(conf.MongoDB.URI)
+	default:
+		log.Fatalf("Unknown rate limit store: '%s'", conf.RateLimit.Store)
 	}
 
-	// Run HTTP server
+	// The repositories are wrapped below, keep what talks to Mongo itself.
+	mongoRepos := []interface{}{authRepo, teamsRepo, journal, rateLimitStore}
+
+	indexesCtx, cancelIndexes := context.WithTimeout(ctx, 5*time.Minute)
+	if err := mongodb.ReconcileIndexes(indexesCtx, mongoRepos...); err != nil {
+		// An unreachable Mongo is not fatal, the repositories reconnect.
+		if conf.MongoDB.StrictIndexes && mongodb.IsIndexConflict(err) {
+			log.WithError(err).Fatal("Failed to reconcile indexes")
+		}
+
+		log.WithError(err).Error("Failed to reconcile indexes")
+	}
+	cancelIndexes()
+
+	// Measured under the caches, so the metrics are of Mongo.
+	teamsRepo = metrics.NewTeamsRepository(teamsRepo)
+	authRepo = metrics.NewAuthorizationsRepository(authRepo)
+	journalRepo := metrics.NewAuthorizationsSyncRepository(journal)
+
+	changes := mongodb.NewChangeStreams(conf.MongoDB.URI)
+
+	authEvents := sse.NewBroker(conf.Events.Buffer)
+
+	go journal.Run(ctx, changes, func(change handler.AuthorizationChange) {
+		event, err := handler.NewAuthorizationEvent(change)
+		if err != nil {
+			log.WithError(err).Error("Failed to encode authorization event")
+			return
+		}
+
+		authEvents.Publish(event)
+	})
+
+	var caches []*cache.Cache
+
+	if conf.Cache.Enabled {
+		cacheConf := cache.Config{
+			TTL:         time.Duration(conf.Cache.TTL) * time.Second,
+			NegativeTTL: time.Duration(conf.Cache.NegativeTTL) * time.Second,
+		}
+		isNotFound := func(err error) bool { return err == handler.ErrNotFound }
+
+		teamsCache := cache.New("teams", cacheConf, isNotFound)
+		authsCache := cache.New("authorizations", cacheConf, isNotFound)
+		caches = append(caches, teamsCache, authsCache)
+		metrics.RegisterCaches(caches...)
+
+		teamsRepo = cache.NewTeamsRepository(teamsRepo, teamsCache)
+		authRepo = cache.NewAuthorizationsRepository(authRepo, authsCache)
+
+		go changes.WatchTeams(ctx, func(e mongodb.ChangeEvent) {
+			teamsCache.Invalidate(e.TeamID)
+		})
+
+		go changes.WatchAuthorizations(ctx, func(e mongodb.ChangeEvent) {
+			authsCache.Invalidate(e.TeamID)
+		})
+	}
+
+	icons, err := icon.NewService(icon.Config{
+		Teams:         teamsRepo,
+		CacheDir:      conf.Icons.CacheDir,
+		CacheMaxAge:   time.Duration(conf.Icons.CacheMaxAge) * time.Second,
+		CacheMaxBytes: int64(conf.Icons.CacheMaxMB) << 20,
+		MaxSize:       conf.Icons.MaxSize,
+	})
+
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to init icon Service`)
+	}
+
+	go icons.RunPruner(ctx, time.Hour)
+
+	if conf.Icons.PublicURL != "" {
+		teamsRepo = icon.NewPlaceholderTeamsRepository(teamsRepo, conf.Icons.PublicURL)
+	}
+
+	accessUsers, err := conf.Access.ParseUsers()
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to load access users`)
+	}
+
+	certUsers, err := conf.TLS.ParseClientUsers()
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to load TLS client users`)
+	}
 
 	authService, err := auth.NewAuthService(auth.Config{
-		UserRepository: database.NewLocalAuthRepository([]config.User{
+		UserRepository: database.NewLocalAuthRepository(append([]config.User{
 			conf.BotUser,
 			conf.MeteorUser,
-		}),
+		}, accessUsers...)),
+		CertificateRepository: database.NewLocalCertificateRepository(certUsers),
 	})
 
 	if err != nil {
 		log.WithError(err).Fatal(`Failed to init AuthService`)
 	}
 
-	authRepo := mongodb.NewSlackBotAuthorizationsRepository(conf.MongoDB.URI)
+	recent := activity.NewLog(conf.Dashboard.Activity)
+
+	// Run AMQP RPC server
 
-	// Register handlers to routes.
-	mux := http.NewServeMux()
-	mux.Handle("/", handler.Empty{})
+	amqpClient := metrics.NewAMQPClient(amqp.NewClient(conf.Amqp.URI))
 
-	h := handler.AllAuthorizations{
-		Repo: authRepo,
+	if err := amqpClient.Connect(ctx); err != nil {
+		log.WithError(err).Fatal("Failed to connect to RabbitMQ")
 	}
-	hndlr := handler.LoadContextMiddleware()(
-		auth.LoadContextMiddleware(authService)(
-			CorsMiddleware(h),
-		),
-	)
 
-	mux.Handle("/allAuthorizations/", hndlr)
-	mux.Handle("/allAuthorizations", hndlr) // Register without a trailing slash to avoid redirect.
+	var anonymousRPC *auth.Principal
+	if !conf.Access.DenyAnonymousRPC && conf.Access.RPCRole != "" {
+		anonymousRPC = &auth.Principal{Name: "rpc", Roles: []auth.Role{auth.Role(conf.Access.RPCRole)}}
+	}
 
-	hOne := handler.GetAuthorization{
-		Repo: authRepo,
+	rpcServer := rpc.NewTeamsRPCServer(amqpClient, teamsRepo, rpc.Access{
+		Auth:      authService,
+		Anonymous: anonymousRPC,
+		Policies: map[string]auth.Permission{
+			"getTeam":            auth.PermReadTeams,
+			"searchTeams":        auth.PermReadTeams,
+			"syncAuthorizations": auth.PermReadTokens,
+			"getAuthorizations":  auth.PermReadTeams,
+		},
+	})
+	rpcServer.Use(metrics.RPC, recent.RPC)
+	rpcServer.Handle("syncAuthorizations", handler.SyncAuthorizationsRPC(journalRepo))
+	rpcServer.Handle("getAuthorizations", handler.GetAuthorizationsRPC(authRepo))
+
+	if err := rpcServer.Run(); err != nil {
+		log.WithError(err).Fatal("Failed to start RpcServer")
 	}
-	hndlrOne := handler.LoadContextMiddleware()(
-		auth.LoadContextMiddleware(authService)(
-			CorsMiddleware(hOne),
-		),
-	)
 
-	mux.Handle("/getAuthorization/", hndlrOne)
-	mux.Handle("/getAuthorization", hndlrOne) // Register without a trailing slash to avoid redirect.
+	// Run HTTP server
 
 	var (
 		readHeaderTimeout = 1 * time.Second
@@ -107,21 +340,187 @@ func main() {
 		maxHeaderBytes    = http.DefaultMaxHeaderBytes
 	)
 
+	// Register handlers to routes. Every route goes through the same middleware chain.
+	rt := router.New()
+	rt.Use(
+		handler.LoadContextMiddleware(),
+		metrics.HTTP,
+		newCORS(conf.CORS, rt.Lookup),
+		auth.LoadContextMiddleware(authService),
+		newAccessLog(conf.AccessLog),
+		recent.HTTP,
+		response.Recover,
+	)
+
+	// Access policies of routes. Icons are public as browsers load them in <img> tags.
+	// Routes of authenticated callers are rate limited after their policy.
+	var (
+		readTeams  = auth.Require(auth.PermReadTeams)
+		readTokens = auth.Require(auth.PermReadTokens)
+		admin      = auth.Require(auth.PermWriteAuthorizations)
+		limited    = newRateLimiter(conf.RateLimit, rateLimitStore)
+	)
+
+	rt.Get("/", http.RedirectHandler(dashboard.Path, http.StatusFound))
+
+	// Probes of the orchestrator and metrics, no authorization needed.
+	rt.Get("/metrics", metrics.Handler())
+	rt.Get("/healthz", health.Liveness())
+	rt.Get("/readyz", health.Readiness(
+		health.Check{
+			Name:    "mongodb",
+			Timeout: time.Duration(conf.Health.MongoTimeout) * time.Millisecond,
+			Run: func(ctx context.Context) error {
+				return mongodb.Ping(ctx, mongoRepos...)
+			},
+		},
+		health.Check{
+			Name:    "amqp",
+			Timeout: time.Duration(conf.Health.AmqpTimeout) * time.Millisecond,
+			Run:     func(ctx context.Context) error { return amqpClient.Err() },
+		},
+		health.Check{
+			Name:    "rpc",
+			Timeout: time.Duration(conf.Health.AmqpTimeout) * time.Millisecond,
+			Run:     func(ctx context.Context) error { return rpcServer.Err() },
+		},
+	))
+
+	allAuthorizations := handler.AllAuthorizations{
+		Repo:     authRepo,
+		Resolver: resolver,
+		Journal:  journalRepo,
+	}
+	getAuthorization := handler.GetAuthorization{
+		Repo: authRepo,
+	}
+	// Older clients get tokens without asking for them.
+	legacyAllAuthorizations := allAuthorizations
+	legacyAllAuthorizations.Legacy = true
+	legacyGetAuthorization := getAuthorization
+	legacyGetAuthorization.Legacy = true
+	searchTeams := handler.SearchTeams{
+		Repo: teamsRepo,
+	}
+	teamIcon := handler.TeamIcon{
+		Icons: icons,
+	}
+
+	rt.Get("/v1/authorizations", allAuthorizations, readTeams, limited)
+	rt.Post("/v1/authorizations/lookup", handler.GetAuthorizations{
+		Repo: authRepo,
+	}, readTeams, limited)
+	rt.Get("/v1/authorizations/changes", handler.SyncAuthorizations{
+		Repo: journalRepo,
+	}, readTokens, limited)
+	rt.Get("/v1/authorizations/events", handler.AuthorizationEvents{
+		Broker:      authEvents,
+		Repo:        journalRepo,
+		Heartbeat:   time.Duration(conf.Events.Heartbeat) * time.Second,
+		MaxDuration: writeTimeout - 10*time.Second,
+	}, readTokens, limited)
+	rt.Get("/v1/teams", searchTeams, readTeams, limited)
+	rt.Get("/v1/teams/{teamId}", handler.GetTeam{
+		Repo: teamsRepo,
+	}, readTeams, limited)
+	rt.Get("/v1/teams/{teamId}/authorization", getAuthorization, readTeams, limited)
+	rt.Get("/v1/teams/{teamId}/icon", teamIcon)
+	rt.Handle(http.MethodHead, "/v1/teams/{teamId}/icon", teamIcon)
+
+	graphqlHandler, err := graph.NewHandler(&graph.Resolver{
+		TeamsRepo:  teamsRepo,
+		AuthRepo:   authRepo,
+		Duplicates: resolver,
+	})
+
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to init GraphQL schema`)
+	}
+
+	// Token fields check read:tokens themselves.
+	rt.Post("/graphql", graphqlHandler, readTeams, limited)
+
+	dash, err := dashboard.New(dashboard.Config{
+		Teams:    teamsRepo,
+		Auths:    authRepo,
+		Resolver: resolver,
+		Auth:     authService,
+		Activity: recent,
+	})
+
+	if err != nil {
+		log.WithError(err).Fatal(`Failed to init dashboard`)
+	}
+
+	// Pages of the dashboard send visitors without a session to sign in.
+	rt.Get("/admin", dash.Teams(), dash.RequireLogin, limited)
+	rt.Get("/admin/teams/{teamId}", dash.Team(), dash.RequireLogin, limited)
+	rt.Get("/admin/duplicates", dash.Duplicates(), dash.RequireLogin, limited)
+	rt.Get("/admin/activity", dash.Activity(), dash.RequireLogin, limited)
+	rt.Get("/admin/login", dash.Login())
+	rt.Post("/admin/login", dash.Login())
+	rt.Post("/admin/logout", dash.Logout())
+	rt.Get("/admin/assets/dashboard.css", dash.Stylesheet())
+
+	rt.Get("/admin/duplicateAuthorizations", handler.DuplicateAuthorizations{
+		Repo:     authRepo,
+		Resolver: resolver,
+	}, admin, limited)
+	rt.Get("/admin/cacheStats", cache.StatsHandler(caches...), admin, limited)
+
+	// Routes of the Slack app are public: Slack sends users back to the callback and
+	// signs the events it posts.
+	if conf.Slack.ClientID != "" || conf.Slack.SigningSecret != "" {
+		installs := mongodb.NewInstallationsRepository(conf.MongoDB.URI)
+
+		if conf.Slack.ClientID != "" {
+			installer := newInstaller(conf.Slack, installs, amqpClient)
+
+			rt.Get("/slack/install", installer.Install())
+			rt.Get("/slack/oauth/callback", installer.Callback())
+		}
+
+		if conf.Slack.SigningSecret != "" {
+			rt.Post("/slack/events", slack.NewReceiver(slack.ReceiverConfig{
+				SigningSecret:  conf.Slack.SigningSecret,
+				Repo:           installs,
+				Events:         amqpClient,
+				EventsExchange: conf.Slack.EventsExchange,
+			}))
+		}
+	}
+
+	// Legacy routes kept for clients that have not moved to /v1 yet.
+	rt.Get("/allAuthorizations", legacyAllAuthorizations, readTokens, limited)
+	rt.Get("/getAuthorization", legacyGetAuthorization, readTokens, limited)
+	rt.Get("/searchTeams", searchTeams, readTeams, limited)
+	rt.Get("/teamIcon", teamIcon)
+	rt.Handle(http.MethodHead, "/teamIcon", teamIcon)
+
 	// Configure the HTTP server.
 	s := &http.Server{
 		Addr:              conf.Addr,
-		Handler:           mux,
+		Handler:           rt,
 		ReadHeaderTimeout: readHeaderTimeout,
 		WriteTimeout:      writeTimeout,
 		IdleTimeout:       idleTimeout,
 		MaxHeaderBytes:    maxHeaderBytes,
 	}
 
+	if conf.TLS.CertFile != "" {
+		s.TLSConfig = newTLSConfig(ctx, conf.TLS)
+	}
+
 	go func() {
 		// Begin listening for requests.
 		log.Printf("Listening for requests on %s", s.Addr)
 
-		if err = s.ListenAndServe(); err != nil {
+		if s.TLSConfig != nil {
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			err = s.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.WithError(err).Fatal("ListenAndServe failed")
 		}
 	}()
@@ -129,10 +528,12 @@ func main() {
 	<-stop
 
 	log.Println("Shutting down the server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	cancelCtx()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel() // releases resources if s.Shutdown completes before timeout elapses
 
-	if err := s.Shutdown(ctx); err != nil {
+	if err := s.Shutdown(shutdownCtx); err != nil {
 		log.WithError(err).Error("Server stopped with errors.")
 	} else {
 		log.Println("Server gracefully stopped.")
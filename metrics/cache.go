@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"bitbucket.org/iwlab-standuply/slackteams-api/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheRequestsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "requests_total"),
+		"Cache lookups by result: hit, negative_hit or miss. The hit ratio is the rate of hits over the rate of all of them.",
+		[]string{"cache", "result"}, nil,
+	)
+
+	cacheItemsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "items"),
+		"Items kept in a cache.",
+		[]string{"cache"}, nil,
+	)
+)
+
+// cacheCollector reads the counters caches keep anyway, so lookups cost nothing more.
+type cacheCollector struct {
+	caches []*cache.Cache
+}
+
+// RegisterCaches exposes statistics of caches.
+func RegisterCaches(caches ...*cache.Cache) {
+	prometheus.MustRegister(&cacheCollector{caches})
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheRequestsDesc
+	ch <- cacheItemsDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, cc := range c.caches {
+		s := cc.Stats()
+
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.Hits), s.Name, "hit")
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.NegativeHits), s.Name, "negative_hit")
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.Misses), s.Name, "miss")
+		ch <- prometheus.MustNewConstMetric(cacheItemsDesc, prometheus.GaugeValue, float64(s.Items), s.Name)
+	}
+}
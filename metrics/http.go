@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	"bitbucket.org/iwlab-standuply/slackteams-api/router"
+)
+
+// unmatched is the route label of requests that match no route, so random paths do not make new series.
+const unmatched = "unmatched"
+
+// knownMethods are kept as labels, clients may send any other method.
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// HTTP measures requests by route, it must be used by a router as routes are told by their patterns.
+func HTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := response.NewRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		route := router.Pattern(r)
+		if route == "" {
+			route = unmatched
+		}
+
+		method := r.Method
+		if !knownMethods[method] {
+			method = "other"
+		}
+
+		labels := []string{route, method, strconv.Itoa(rec.Status())}
+
+		httpRequests.WithLabelValues(labels...).Inc()
+		httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
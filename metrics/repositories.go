@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+)
+
+// observe records an operation of a repository that started at start and returned err.
+func observe(repository string, operation string, start time.Time, err error) {
+	repoDuration.WithLabelValues(repository, operation).Observe(time.Since(start).Seconds())
+
+	if err != nil && errors.KindOf(err) != errors.KindNotFound {
+		repoErrors.WithLabelValues(repository, operation).Inc()
+	}
+}
+
+type teamsRepository struct {
+	repo rpc.SlackTeamsRepository
+}
+
+// NewTeamsRepository measures operations of repo, wrap it under caches to measure the database.
+func NewTeamsRepository(repo rpc.SlackTeamsRepository) rpc.SlackTeamsRepository {
+	return &teamsRepository{repo}
+}
+
+func (r *teamsRepository) FindTeamByID(ctx context.Context, teamID string) (_ *rpc.SlackTeam, err error) {
+	defer func(start time.Time) { observe("teams", "FindTeamByID", start, err) }(time.Now())
+
+	return r.repo.FindTeamByID(ctx, teamID)
+}
+
+func (r *teamsRepository) SearchTeams(ctx context.Context, query rpc.TeamSearchQuery) (_ *rpc.TeamSearchResult, err error) {
+	defer func(start time.Time) { observe("teams", "SearchTeams", start, err) }(time.Now())
+
+	return r.repo.SearchTeams(ctx, query)
+}
+
+type authorizationsRepository struct {
+	repo handler.AuthorizationsRepository
+}
+
+// NewAuthorizationsRepository measures operations of repo, wrap it under caches to measure the database.
+func NewAuthorizationsRepository(repo handler.AuthorizationsRepository) handler.AuthorizationsRepository {
+	return &authorizationsRepository{repo}
+}
+
+func (r *authorizationsRepository) GetAllAuthorizations(ctx context.Context) (_ []*handler.SlackBotAuthorization, err error) {
+	defer func(start time.Time) { observe("authorizations", "GetAllAuthorizations", start, err) }(time.Now())
+
+	return r.repo.GetAllAuthorizations(ctx)
+}
+
+func (r *authorizationsRepository) GetAuthorization(ctx context.Context, teamId string) (_ *handler.SlackBotAuthorization, err error) {
+	defer func(start time.Time) { observe("authorizations", "GetAuthorization", start, err) }(time.Now())
+
+	return r.repo.GetAuthorization(ctx, teamId)
+}
+
+func (r *authorizationsRepository) GetAuthorizations(ctx context.Context, teamIDs []string) (_ *handler.AuthorizationsBatch, err error) {
+	defer func(start time.Time) { observe("authorizations", "GetAuthorizations", start, err) }(time.Now())
+
+	return r.repo.GetAuthorizations(ctx, teamIDs)
+}
+
+type authorizationsSyncRepository struct {
+	repo handler.AuthorizationsSyncRepository
+}
+
+// NewAuthorizationsSyncRepository measures reads of the journal of authorization changes.
+func NewAuthorizationsSyncRepository(repo handler.AuthorizationsSyncRepository) handler.AuthorizationsSyncRepository {
+	return &authorizationsSyncRepository{repo}
+}
+
+func (r *authorizationsSyncRepository) AuthorizationsSince(ctx context.Context, cursor string, limit int) (_ *handler.AuthorizationsDelta, err error) {
+	defer func(start time.Time) { observe("authorizationJournal", "AuthorizationsSince", start, err) }(time.Now())
+
+	return r.repo.AuthorizationsSince(ctx, cursor, limit)
+}
+
+func (r *authorizationsSyncRepository) LastModified(ctx context.Context) (_ time.Time, err error) {
+	defer func(start time.Time) { observe("authorizationJournal", "LastModified", start, err) }(time.Now())
+
+	return r.repo.LastModified(ctx)
+}
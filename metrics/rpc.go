@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/amqp"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countedMessage counts how a message is acknowledged.
+type countedMessage struct {
+	amqp.ConsumerMessage
+	routingKey string
+}
+
+func (m *countedMessage) Ack(multiple bool) error {
+	err := m.ConsumerMessage.Ack(multiple)
+	if err == nil {
+		rpcMessages.WithLabelValues(m.routingKey, "acked").Inc()
+	}
+
+	return err
+}
+
+func (m *countedMessage) Nack(multiple, requeue bool) error {
+	err := m.ConsumerMessage.Nack(multiple, requeue)
+	if err == nil {
+		rpcMessages.WithLabelValues(m.routingKey, "nacked").Inc()
+	}
+
+	return err
+}
+
+func (m *countedMessage) Reject(requeue bool) error {
+	err := m.ConsumerMessage.Reject(requeue)
+	if err == nil {
+		rpcMessages.WithLabelValues(m.routingKey, "nacked").Inc()
+	}
+
+	return err
+}
+
+// RPC measures messages of an RPC method, it is a middleware of rpc.Server.
+func RPC(routingKey string, next rpc.MessageHandler) rpc.MessageHandler {
+	return func(m amqp.ConsumerMessage) error {
+		rpcMessages.WithLabelValues(routingKey, "consumed").Inc()
+		start := time.Now()
+
+		err := next(&countedMessage{ConsumerMessage: m, routingKey: routingKey})
+
+		rpcDuration.WithLabelValues(routingKey).Observe(time.Since(start).Seconds())
+		if err != nil {
+			rpcMessages.WithLabelValues(routingKey, "failed").Inc()
+		}
+
+		return err
+	}
+}
+
+type amqpClient struct {
+	amqp.Client
+}
+
+// NewAMQPClient counts RPC requests of c waiting for replies and exposes whether c is connected.
+// Only one client may be measured, the metrics of a second one would collide.
+func NewAMQPClient(c amqp.Client) amqp.Client {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "amqp_connected",
+		Help:      "Whether the connection to RabbitMQ is up and publishing works.",
+	}, func() float64 {
+		if c.Err() != nil {
+			return 0
+		}
+		return 1
+	}))
+
+	return &amqpClient{c}
+}
+
+func (c *amqpClient) Request(ctx context.Context, params amqp.RequestParams) ([]byte, error) {
+	amqpPendingReplies.Inc()
+	defer amqpPendingReplies.Dec()
+
+	return c.Client.Request(ctx, params)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/config"
+	"bitbucket.org/iwlab-standuply/slackteams-api/database/mongodb"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const migrateUsage = `Usage: slackteams-api migrate <command> [-dry-run]
+
+Commands:
+  status    list migrations and whether they are applied
+  up        apply pending migrations
+`
+
+// runMigrate implements the `migrate` command. It exits the process when done.
+func runMigrate(conf config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "count affected documents without changing anything")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+	_ = fs.Parse(args[1:])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	migrator := mongodb.NewMigrator(conf.MongoDB.URI)
+	defer migrator.Close(context.Background())
+
+	var (
+		statuses []mongodb.MigrationStatus
+		err      error
+	)
+
+	switch args[0] {
+	case "status":
+		statuses, err = migrator.Status(ctx)
+	case "up":
+		statuses, err = migrator.Apply(ctx, *dryRun)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	printMigrations(statuses, *dryRun)
+
+	if err != nil {
+		log.WithError(err).Fatal("Migrate failed")
+	}
+}
+
+// migrateOnStart applies pending migrations when AutoMigrate is enabled. Otherwise it refuses to start
+// while any is pending, as the service reads documents only in the shape the migrations leave them.
+func migrateOnStart(conf config.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	migrator := mongodb.NewMigrator(conf.MongoDB.URI)
+	defer migrator.Close(context.Background())
+
+	if conf.MongoDB.AutoMigrate {
+		if _, err := migrator.Apply(ctx, false); err != nil {
+			log.WithError(err).Fatal("Failed to apply migrations")
+		}
+
+		return
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to check pending migrations")
+		return
+	}
+
+	for _, m := range pending {
+		log.Errorf("Migration %d (%s) is not applied", m.Version, m.Name)
+	}
+
+	if len(pending) > 0 {
+		log.Fatal("Migrations are pending, run `migrate up` or set ST_API_MONGODB_AUTOMIGRATE=true")
+	}
+}
+
+func printMigrations(statuses []mongodb.MigrationStatus, dryRun bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\tAFFECTED")
+
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if dryRun {
+			appliedAt = "dry run"
+		}
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\n", s.Version, s.Name, appliedAt, s.Affected)
+	}
+}
@@ -0,0 +1,180 @@
+// Package ratelimit throttles API callers with token buckets per caller and route, and daily quotas per caller.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	"bitbucket.org/iwlab-standuply/slackteams-api/router"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errRateLimited   = errors.E(errors.KindRateLimited, "rate limit exceeded")
+	errQuotaExceeded = errors.E(errors.KindRateLimited, "daily quota exceeded")
+)
+
+// Limit of a token bucket: it holds up to Burst requests and refills at Rate requests per second.
+// A zero Rate means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result of a request against a bucket or a quota.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long a caller that was not allowed should wait.
+	RetryAfter time.Duration
+}
+
+// Store keeps buckets and quota counters. Its methods must be atomic per key,
+// as instances of the API share a store.
+type Store interface {
+	// Take takes a request from the bucket of key.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	// Count counts a request against the daily quota of key, days are UTC days.
+	Count(ctx context.Context, key string, quota int, now time.Time) (Result, error)
+}
+
+type Config struct {
+	Store Store
+	// Default is the limit of routes without one of their own.
+	Default Limit
+	// Routes are limits of route patterns, like /v1/teams/{teamId}.
+	Routes map[string]Limit
+	// DailyQuota is how many requests a caller may make a day over all routes. Zero disables quotas.
+	DailyQuota int
+}
+
+// Limiter throttles authenticated callers, anonymous requests are not limited.
+type Limiter struct {
+	conf Config
+	now  func() time.Time
+}
+
+func New(conf Config) *Limiter {
+	return &Limiter{
+		conf: conf,
+		now:  time.Now,
+	}
+}
+
+// Middleware limits a route, it must wrap routes of a router as it tells routes by their patterns.
+// When the store fails requests are let through, as throttling is not worth an outage.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		p, ok := auth.PrincipalFromContext(ctx)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := router.Pattern(r)
+		now := l.now()
+
+		if limit := l.limit(route); limit.Rate > 0 {
+			res, err := l.conf.Store.Take(ctx, p.Name+" "+r.Method+" "+route, limit, now)
+			if err != nil {
+				log.WithContext(ctx).WithError(err).Warn("Failed to check rate limit")
+			} else {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+
+				if !res.Allowed {
+					deny(w, r, res, errRateLimited)
+					return
+				}
+			}
+		}
+
+		if l.conf.DailyQuota > 0 {
+			res, err := l.conf.Store.Count(ctx, p.Name, l.conf.DailyQuota, now)
+			if err != nil {
+				log.WithContext(ctx).WithError(err).Warn("Failed to check daily quota")
+			} else {
+				w.Header().Set("X-Quota-Limit", strconv.Itoa(l.conf.DailyQuota))
+				w.Header().Set("X-Quota-Remaining", strconv.Itoa(res.Remaining))
+
+				if !res.Allowed {
+					deny(w, r, res, errQuotaExceeded)
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) limit(route string) Limit {
+	if limit, ok := l.conf.Routes[route]; ok {
+		return limit
+	}
+
+	return l.conf.Default
+}
+
+func deny(w http.ResponseWriter, r *http.Request, res Result, err error) {
+	seconds := int(math.Ceil(res.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	log.WithContext(r.Context()).WithField("route", router.Pattern(r)).Info(errors.MessageOf(err))
+	response.Error(w, r, err)
+}
+
+// BucketResult is the result of a request to a bucket left with tokens after it.
+func BucketResult(allowed bool, tokens float64, limit Limit) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+	}
+
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	}
+
+	return res
+}
+
+// QuotaResult is the result of the count-th request of the day of now.
+func QuotaResult(count int, quota int, now time.Time) Result {
+	res := Result{
+		Allowed:   count <= quota,
+		Remaining: quota - count,
+	}
+
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+
+	if !res.Allowed {
+		res.RetryAfter = NextDay(now).Sub(now)
+	}
+
+	return res
+}
+
+// Day names the UTC day of t, quota counters are kept per day.
+func Day(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// NextDay is when quotas of the day of t are reset.
+func NextDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed bool
+		tokens  float64
+		limit   Limit
+		want    Result
+	}{
+		{"allowed", true, 4.7, Limit{Rate: 1, Burst: 10}, Result{Allowed: true, Remaining: 4}},
+		{"last token", true, 0, Limit{Rate: 1, Burst: 10}, Result{Allowed: true, Remaining: 0}},
+		{"empty", false, 0, Limit{Rate: 1, Burst: 10}, Result{Allowed: false, Remaining: 0, RetryAfter: time.Second}},
+		{"almost a token", false, 0.75, Limit{Rate: 1, Burst: 10}, Result{Allowed: false, Remaining: 0, RetryAfter: 250 * time.Millisecond}},
+		{"fast rate", false, 0, Limit{Rate: 10, Burst: 10}, Result{Allowed: false, Remaining: 0, RetryAfter: 100 * time.Millisecond}},
+		{"per minute", false, 0.5, Limit{Rate: 1.0 / 60, Burst: 1}, Result{Allowed: false, Remaining: 0, RetryAfter: 30 * time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BucketResult(tt.allowed, tt.tokens, tt.limit); got != tt.want {
+				t.Errorf("BucketResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaResult(t *testing.T) {
+	now := time.Date(2026, 1, 2, 23, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		count int
+		quota int
+		want  Result
+	}{
+		{"first", 1, 3, Result{Allowed: true, Remaining: 2}},
+		{"last", 3, 3, Result{Allowed: true, Remaining: 0}},
+		{"over", 4, 3, Result{Allowed: false, Remaining: 0, RetryAfter: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuotaResult(tt.count, tt.quota, now); got != tt.want {
+				t.Errorf("QuotaResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
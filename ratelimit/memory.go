@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that refilled and counters of past days are dropped.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+	// full is when the bucket refills completely, it can be dropped after that.
+	full time.Time
+}
+
+// MemoryStore keeps buckets and quotas in memory. Every instance of the API
+// limits callers on its own, use a shared store when there are several.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	counts    map[string]int
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		counts:  map[string]int{},
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), at: now}
+		s.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.at); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * limit.Rate
+		b.at = now
+	}
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)))
+
+	return BucketResult(allowed, b.tokens, limit), nil
+}
+
+func (s *MemoryStore) Count(ctx context.Context, key string, quota int, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	key = Day(now) + " " + key
+	s.counts[key]++
+
+	return QuotaResult(s.counts[key], quota, now), nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+
+	today := Day(now)
+	for key := range s.counts {
+		if key[:len(today)] != today {
+			delete(s.counts, key)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	limit := Limit{Rate: 1, Burst: 3}
+
+	type take struct {
+		after time.Duration
+		want  Result
+	}
+
+	tests := []struct {
+		name  string
+		limit Limit
+		takes []take
+	}{
+		{
+			name:  "burst then throttled",
+			limit: limit,
+			takes: []take{
+				{0, Result{Allowed: true, Remaining: 2}},
+				{0, Result{Allowed: true, Remaining: 1}},
+				{0, Result{Allowed: true, Remaining: 0}},
+				{0, Result{Allowed: false, Remaining: 0, RetryAfter: time.Second}},
+			},
+		},
+		{
+			name:  "refills at the rate",
+			limit: limit,
+			takes: []take{
+				{0, Result{Allowed: true, Remaining: 2}},
+				{0, Result{Allowed: true, Remaining: 1}},
+				{0, Result{Allowed: true, Remaining: 0}},
+				{500 * time.Millisecond, Result{Allowed: false, Remaining: 0, RetryAfter: 500 * time.Millisecond}},
+				{time.Second, Result{Allowed: true, Remaining: 0}},
+			},
+		},
+		{
+			name:  "refills up to the burst",
+			limit: limit,
+			takes: []take{
+				{0, Result{Allowed: true, Remaining: 2}},
+				{time.Hour, Result{Allowed: true, Remaining: 2}},
+			},
+		},
+		{
+			name:  "slow rate",
+			limit: Limit{Rate: 0.5, Burst: 1},
+			takes: []take{
+				{0, Result{Allowed: true, Remaining: 0}},
+				{time.Second, Result{Allowed: false, Remaining: 0, RetryAfter: time.Second}},
+				{2 * time.Second, Result{Allowed: true, Remaining: 0}},
+			},
+		},
+		{
+			name:  "clock going back",
+			limit: limit,
+			takes: []take{
+				{0, Result{Allowed: true, Remaining: 2}},
+				{-time.Minute, Result{Allowed: true, Remaining: 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+
+			for i, tk := range tt.takes {
+				got, err := s.Take(context.Background(), "key", tt.limit, start.Add(tk.after))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tk.want {
+					t.Errorf("take #%d at %v = %+v, want %+v", i+1, tk.after, got, tk.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTakeKeys(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	limit := Limit{Rate: 1, Burst: 1}
+	s := NewMemoryStore()
+
+	if res, _ := s.Take(context.Background(), "a", limit, now); !res.Allowed {
+		t.Fatalf("first request of a throttled")
+	}
+	if res, _ := s.Take(context.Background(), "a", limit, now); res.Allowed {
+		t.Errorf("second request of a allowed")
+	}
+	if res, _ := s.Take(context.Background(), "b", limit, now); !res.Allowed {
+		t.Errorf("b throttled by a")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	limit := Limit{Rate: 1, Burst: 2}
+	s := NewMemoryStore()
+
+	s.Take(context.Background(), "full", limit, now)
+	s.Take(context.Background(), "empty", Limit{Rate: 0.000001, Burst: 2}, now)
+	s.Take(context.Background(), "empty", Limit{Rate: 0.000001, Burst: 2}, now)
+	s.Count(context.Background(), "caller", 10, now)
+
+	s.Take(context.Background(), "other", limit, now.Add(25*time.Hour))
+
+	if _, ok := s.buckets["full"]; ok {
+		t.Errorf("refilled bucket was not dropped")
+	}
+	if _, ok := s.buckets["empty"]; !ok {
+		t.Errorf("bucket still refilling was dropped")
+	}
+	if len(s.counts) != 0 {
+		t.Errorf("counters of past days were not dropped: %v", s.counts)
+	}
+}
@@ -0,0 +1,59 @@
+package response
+
+import "net/http"
+
+// Recorder keeps the status a handler answered with and the size of the body, for middlewares
+// that report on responses. It passes flushes through, so event streams keep working behind it.
+type Recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+func (w *Recorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *Recorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+
+	return n, err
+}
+
+func (w *Recorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Status is the status written so far, 200 when the handler wrote nothing.
+func (w *Recorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+// Bytes is how many bytes of the body were written so far.
+func (w *Recorder) Bytes() int {
+	return w.bytes
+}
+
+// Written reports whether the status was sent, after which it cannot be changed.
+func (w *Recorder) Written() bool {
+	return w.status != 0
+}
@@ -0,0 +1,43 @@
+package response
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var errPanic = errors.E(errors.KindInternal, "internal error")
+
+// Recover turns a panic of the next handler into a logged 500. When the response has already
+// started it cannot be changed, so the connection is aborted to let the client know it is broken.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := NewRecorder(w)
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			log.WithContext(r.Context()).WithFields(log.Fields{
+				"panic": fmt.Sprint(v),
+				"stack": string(debug.Stack()),
+			}).Errorf("%s %s panicked", r.Method, r.URL.Path)
+
+			if rec.Written() {
+				panic(http.ErrAbortHandler)
+			}
+
+			writeError(rec, r, errPanic)
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
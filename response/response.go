@@ -0,0 +1,90 @@
+// Package response writes API responses, errors in particular, the same way for every endpoint.
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type CtxKey string
+
+const (
+	CtxKeyRequestID CtxKey = "requestId"
+)
+
+// RequestIDHeader carries the request ID back to clients, so they can refer to a request in reports.
+const RequestIDHeader = "X-Request-ID"
+
+var statuses = map[errors.Kind]int{
+	errors.KindInvalid:          http.StatusBadRequest,
+	errors.KindUnauthorized:     http.StatusUnauthorized,
+	errors.KindForbidden:        http.StatusForbidden,
+	errors.KindNotFound:         http.StatusNotFound,
+	errors.KindMethodNotAllowed: http.StatusMethodNotAllowed,
+	errors.KindConflict:         http.StatusConflict,
+	errors.KindGone:             http.StatusGone,
+	errors.KindRateLimited:      http.StatusTooManyRequests,
+	errors.KindInternal:         http.StatusInternalServerError,
+	errors.KindUnavailable:      http.StatusServiceUnavailable,
+}
+
+type errorBody struct {
+	OK    bool        `json:"ok"`
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code      errors.Kind `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+// RequestID returns the ID LoadContextMiddleware of the handler package gave the request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(CtxKeyRequestID).(string)
+	return id
+}
+
+// Status is the HTTP status of err.
+func Status(err error) int {
+	return statuses[errors.KindOf(err)]
+}
+
+// JSON writes a JSON body.
+func JSON(w http.ResponseWriter, body []byte, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if _, err := w.Write(body); err != nil {
+		log.WithError(err).Debug("Write in response.JSON failed")
+	}
+}
+
+// Error writes err as {ok: false, error: {code, message, requestId}} with the status of its kind.
+// Internal errors are logged, clients only get a generic message for them.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	if kind := errors.KindOf(err); kind == errors.KindInternal || kind == errors.KindUnavailable {
+		log.WithContext(r.Context()).WithError(err).Errorf("%s %s failed", r.Method, r.URL.Path)
+	}
+
+	writeError(w, r, err)
+}
+
+// writeError writes err without logging it.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	kind := errors.KindOf(err)
+
+	body, _ := json.Marshal(errorBody{
+		Error: errorDetail{
+			Code:      kind,
+			Message:   errors.MessageOf(err),
+			RequestID: RequestID(r.Context()),
+		},
+	})
+
+	JSON(w, body, statuses[kind])
+}
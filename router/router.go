@@ -0,0 +1,219 @@
+// Package router dispatches HTTP requests by method and path patterns with named parameters.
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+)
+
+var (
+	errNotFound         = errors.E(errors.KindNotFound, "not found")
+	errMethodNotAllowed = errors.E(errors.KindMethodNotAllowed, "method not allowed")
+)
+
+type ctxKey string
+
+const ctxKeyRoute ctxKey = "routerRoute"
+
+// routeContext is filled in when a route matches. It is put in the context before
+// the middlewares of Use run, so they can tell the route after calling the next handler.
+type routeContext struct {
+	pattern string
+	params  map[string]string
+}
+
+// Middleware wraps a handler, e.g. to load the request context.
+type Middleware func(http.Handler) http.Handler
+
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  http.Handler
+}
+
+// Router matches requests against registered routes. Patterns are paths
+// where a segment in braces, like /v1/teams/{teamId}, matches any single segment.
+// A trailing slash in the request path is ignored.
+type Router struct {
+	routes      []route
+	middlewares []Middleware
+	// chain is the middlewares around dispatch, composed on the first request.
+	chain     http.Handler
+	chainOnce sync.Once
+	// NotFound serves requests that match no route.
+	NotFound http.Handler
+}
+
+func New() *Router {
+	return &Router{
+		NotFound: http.HandlerFunc(notFound),
+	}
+}
+
+// Use appends middlewares to the chain every request goes through, including
+// those that match no route. The first middleware is the outermost one.
+// The chain is composed on the first request, middlewares used later are ignored.
+func (rt *Router) Use(middlewares ...Middleware) {
+	rt.middlewares = append(rt.middlewares, middlewares...)
+}
+
+// Handle registers h for requests with method to paths matching pattern.
+// Middlewares only wrap this route, inside the chain of Use, e.g. to declare its access policy.
+func (rt *Router) Handle(method string, pattern string, h http.Handler, middlewares ...Middleware) {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		pattern:  pattern,
+		segments: split(pattern),
+		handler:  h,
+	})
+}
+
+func (rt *Router) Get(pattern string, h http.Handler, middlewares ...Middleware) {
+	rt.Handle(http.MethodGet, pattern, h, middlewares...)
+}
+
+func (rt *Router) Post(pattern string, h http.Handler, middlewares ...Middleware) {
+	rt.Handle(http.MethodPost, pattern, h, middlewares...)
+}
+
+// Lookup returns the pattern of the first route matching path, whatever its method, or an empty string.
+// It lets middlewares of Use tell the route before the request is dispatched.
+func (rt *Router) Lookup(path string) string {
+	segments := split(path)
+
+	for _, rte := range rt.routes {
+		if _, ok := match(rte.segments, segments); ok {
+			return rte.pattern
+		}
+	}
+
+	return ""
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(context.WithValue(r.Context(), ctxKeyRoute, &routeContext{}))
+
+	rt.chainOnce.Do(func() {
+		var h http.Handler = http.HandlerFunc(rt.dispatch)
+
+		for i := len(rt.middlewares) - 1; i >= 0; i-- {
+			h = rt.middlewares[i](h)
+		}
+
+		rt.chain = h
+	})
+
+	rt.chain.ServeHTTP(w, r)
+}
+
+func (rt *Router) dispatch(w http.ResponseWriter, r *http.Request) {
+	segments := split(r.URL.Path)
+	allowed := map[string]bool{}
+
+	for _, rte := range rt.routes {
+		params, ok := match(rte.segments, segments)
+		if !ok {
+			continue
+		}
+
+		if rte.method != r.Method {
+			allowed[rte.method] = true
+			continue
+		}
+
+		if rc, ok := r.Context().Value(ctxKeyRoute).(*routeContext); ok {
+			rc.pattern = rte.pattern
+			rc.params = params
+		}
+
+		rte.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if len(allowed) == 0 {
+		rt.NotFound.ServeHTTP(w, r)
+		return
+	}
+
+	methods := make([]string, 0, len(allowed))
+	for m := range allowed {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	response.Error(w, r, errMethodNotAllowed)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	response.Error(w, r, errNotFound)
+}
+
+// Param returns the value of a path parameter of the matched route, or an empty string.
+func Param(r *http.Request, name string) string {
+	rc, ok := r.Context().Value(ctxKeyRoute).(*routeContext)
+	if !ok {
+		return ""
+	}
+
+	return rc.params[name]
+}
+
+// Pattern returns the pattern of the matched route, e.g. /v1/teams/{teamId}, or an empty string.
+// Unlike the path it names the route, whatever the parameters are. Middlewares of Use
+// only see it once the next handler has been called.
+func Pattern(r *http.Request) string {
+	rc, ok := r.Context().Value(ctxKeyRoute).(*routeContext)
+	if !ok {
+		return ""
+	}
+
+	return rc.pattern
+}
+
+func match(pattern []string, path []string) (map[string]string, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+
+	var params map[string]string
+
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if path[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[p[1:len(p)-1]] = path[i]
+			continue
+		}
+
+		if p != path[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func split(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"context"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/amqp"
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+)
+
+var (
+	ErrForbidden = errors.E(errors.KindForbidden, "forbidden")
+)
+
+// AuthorizationHeader is the message header with the token of the caller.
+const AuthorizationHeader = "authorization"
+
+// Access is the access policy of RPC methods.
+type Access struct {
+	Auth auth.Service
+	// Anonymous is the principal of requests without a token, nil denies them.
+	Anonymous *auth.Principal
+	// Policies maps routing keys to the permission a caller needs. Methods without a policy are denied.
+	Policies map[string]auth.Permission
+}
+
+// authorize returns the principal of m if it may call the method.
+func (a Access) authorize(ctx context.Context, routingKey string, m amqp.ConsumerMessage) (*auth.Principal, error) {
+	perm, ok := a.Policies[routingKey]
+	if !ok {
+		return nil, ErrForbidden
+	}
+
+	principal := a.Anonymous
+
+	if token, ok := m.GetHeaders()[AuthorizationHeader].(string); ok && token != "" {
+		p, err := a.Auth.FindPrincipalByToken(ctx, token)
+		if err != nil {
+			return nil, ErrForbidden
+		}
+		principal = p
+	}
+
+	if !principal.Can(perm) {
+		return nil, ErrForbidden
+	}
+
+	return principal, nil
+}
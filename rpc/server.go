@@ -4,33 +4,71 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"bitbucket.org/iwlab-standuply/slackteams-api/amqp"
+	"bitbucket.org/iwlab-standuply/slackteams-api/auth"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
 	ErrStanduplyClientResponseType = errors.New("standuply response has invalid type")
+	ErrNotRunning                  = errors.New("not running")
 )
 
 type Services struct {
 }
 
 type Server interface {
+	// Handle registers a method served by h, it must be called before Run.
+	Handle(routingKey string, h HandlerFunc)
+	// Use appends middlewares every message goes through, it must be called before Run.
+	// The first middleware is the outermost one.
+	Use(middlewares ...Middleware)
 	Run() error
+	// Err tells why the server does not serve every method, it is nil while all consumers run.
+	Err() error
 }
 
-func NewTeamsRPCServer(amqpClient amqp.Client, repo SlackTeamsRepository) Server {
+// HandlerFunc serves an RPC method. It gets the raw request body and returns the response data.
+type HandlerFunc func(ctx context.Context, body []byte) (interface{}, error)
+
+// MessageHandler handles and acks a message. It returns the error the request was answered with.
+type MessageHandler func(m amqp.ConsumerMessage) error
+
+// Middleware wraps the handling of messages of a method, e.g. to measure it.
+type Middleware func(routingKey string, next MessageHandler) MessageHandler
+
+// delivery keeps the caller of a message and the error it was answered with, as handlers answer errors themselves.
+type delivery struct {
+	amqp.ConsumerMessage
+	principal *auth.Principal
+	err       error
+}
+
+func NewTeamsRPCServer(amqpClient amqp.Client, repo SlackTeamsRepository, access Access) Server {
 	return &rpcServer{
-		c:    amqpClient,
-		repo: repo,
+		c:        amqpClient,
+		repo:     repo,
+		access:   access,
+		handlers: map[string]HandlerFunc{},
 	}
 }
 
 type rpcServer struct {
-	c    amqp.Client
-	repo SlackTeamsRepository
+	c        amqp.Client
+	repo     SlackTeamsRepository
+	access   Access
+	handlers map[string]HandlerFunc
+
+	middlewares []Middleware
+
+	mu        sync.Mutex
+	consumers map[string]bool
 }
 
 type getTeamByIDRequest struct {
@@ -38,46 +76,137 @@ type getTeamByIDRequest struct {
 }
 
 func (s *rpcServer) Run() error {
-	if err := s.observeGetTeam(); err != nil {
+	s.mu.Lock()
+	s.consumers = map[string]bool{}
+	s.mu.Unlock()
+
+	if err := s.observe("getTeam", s.handleGetTeam); err != nil {
+		return err
+	}
+
+	if err := s.observe("searchTeams", s.handleSearchTeams); err != nil {
 		return err
 	}
 
+	for routingKey, h := range s.handlers {
+		if err := s.observe(routingKey, s.handleFunc(routingKey, h)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (s *rpcServer) Handle(routingKey string, h HandlerFunc) {
+	s.handlers[routingKey] = h
+}
+
+func (s *rpcServer) Use(middlewares ...Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+func (s *rpcServer) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.consumers == nil {
+		return ErrNotRunning
+	}
+
+	var stopped []string
+	for routingKey, running := range s.consumers {
+		if !running {
+			stopped = append(stopped, routingKey)
+		}
+	}
+
+	if len(stopped) > 0 {
+		sort.Strings(stopped)
+		return fmt.Errorf("consumers stopped: %s", strings.Join(stopped, ", "))
+	}
+
+	return nil
+}
+
+func (s *rpcServer) setConsumer(routingKey string, running bool) {
+	s.mu.Lock()
+	s.consumers[routingKey] = running
+	s.mu.Unlock()
+}
+
 type simpleResponse struct {
 	OK    bool    `json:"ok"`
 	Error *string `json:"error,omitempty"`
 }
 
 type teamResponse struct {
-	OK    bool      `json:"ok"`
-	Error *string   `json:"error,omitempty"`
+	OK    bool       `json:"ok"`
+	Error *string    `json:"error,omitempty"`
 	Data  *SlackTeam `json:"data"`
 }
 
-func (s *rpcServer) observeGetTeam() error {
-	messages, err := s.c.ConsumeRPCRequests("getTeam")
+type dataResponse struct {
+	OK    bool        `json:"ok"`
+	Error *string     `json:"error,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+type searchTeamsResponse struct {
+	OK    bool              `json:"ok"`
+	Error *string           `json:"error,omitempty"`
+	Data  *TeamSearchResult `json:"data"`
+}
+
+func (s *rpcServer) observe(routingKey string, handle func(m amqp.ConsumerMessage)) error {
+	messages, err := s.c.ConsumeRPCRequests(routingKey)
 
 	if err != nil {
 		return err
 	}
 
+	var h MessageHandler = func(m amqp.ConsumerMessage) error {
+		d := &delivery{ConsumerMessage: m}
+
+		if p, err := s.authorize(routingKey, m); err != nil {
+			s.responseWithError(context.Background(), d, err, "RPC request to "+routingKey+" denied")
+		} else {
+			d.principal = p
+			s.handleSafely(handle, d)
+		}
+
+		err := m.Ack(false)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to ack message %+v", m)
+		}
+		log.Debugf("Message ack")
+
+		return d.err
+	}
+
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		h = s.middlewares[i](routingKey, h)
+	}
+
+	s.setConsumer(routingKey, true)
+
 	go func() {
-		for m := range messages {
-			s.handleSafely(s.handleGetTeam, m)
+		defer s.setConsumer(routingKey, false)
 
-			err := m.Ack(false)
-			if err != nil {
-				log.WithError(err).Errorf("Failed to ack message %+v", m)
-			}
-			log.Debugf("Message ack")
+		for m := range messages {
+			h(m)
 		}
 	}()
 
 	return nil
 }
 
+func (s *rpcServer) authorize(routingKey string, m amqp.ConsumerMessage) (*auth.Principal, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	return s.access.authorize(ctx, routingKey, m)
+}
+
 func (s *rpcServer) handleGetTeam(m amqp.ConsumerMessage) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
 	defer cancel()
@@ -106,6 +235,56 @@ func (s *rpcServer) handleGetTeam(m amqp.ConsumerMessage) {
 	s.response(ctx, m, payload)
 }
 
+func (s *rpcServer) handleSearchTeams(m amqp.ConsumerMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
+	defer cancel()
+
+	payload := searchTeamsResponse{
+		OK: true,
+	}
+
+	var q TeamSearchQuery
+
+	err := json.Unmarshal(m.GetBody(), &q)
+
+	if err != nil {
+		s.responseWithError(ctx, m, err, "Failed to unmarshall searchTeams event")
+		return
+	}
+
+	res, err := s.repo.SearchTeams(ctx, q.Normalize())
+	if err != nil {
+		s.responseWithError(ctx, m, err, "Failed to search teams")
+		return
+	}
+	log.Debugf("SearchTeams %+v - %d of %d", q, len(res.Teams), res.Total)
+
+	payload.Data = res
+	s.response(ctx, m, payload)
+}
+
+func (s *rpcServer) handleFunc(routingKey string, h HandlerFunc) func(m amqp.ConsumerMessage) {
+	return func(m amqp.ConsumerMessage) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
+		defer cancel()
+
+		if d, ok := m.(*delivery); ok && d.principal != nil {
+			ctx = context.WithValue(ctx, auth.CtxKeyPrincipal, d.principal)
+		}
+
+		data, err := h(ctx, m.GetBody())
+		if err != nil {
+			s.responseWithError(ctx, m, err, "Failed to handle "+routingKey)
+			return
+		}
+
+		s.response(ctx, m, dataResponse{
+			OK:   true,
+			Data: data,
+		})
+	}
+}
+
 func (s *rpcServer) response(ctx context.Context, message amqp.ConsumerMessage, payload interface{}) {
 	err := s.c.PublishRPCResponse(ctx, amqp.RPCResponseParams{
 		RoutingKey: message.GetReplyTo(),
@@ -120,6 +299,10 @@ func (s *rpcServer) response(ctx context.Context, message amqp.ConsumerMessage,
 func (s *rpcServer) responseWithError(ctx context.Context, message amqp.ConsumerMessage, err error, msg string) {
 	log.WithError(err).Error(msg)
 
+	if d, ok := message.(*delivery); ok {
+		d.err = err
+	}
+
 	errMessage := err.Error()
 	payload := simpleResponse{
 		OK:    false,
@@ -22,7 +22,7 @@ type SlackTeam struct {
 	EmailDomain string     `json:"emailDomain"`
 	Icon        SlackIcon  `json:"icon"`
 	IsDeleted   bool       `json:"isDeleted"`
-	DeletedAt   *time.Time `json:"deletedAt, omitempty"`
-	CreatedAt   time.Time  `json:"createdAt, omitempty"`
-	Tags        *[]string  `json:"tags, omitempty"`
+	DeletedAt   *time.Time `json:"deletedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	Tags        *[]string  `json:"tags"`
 }
@@ -4,4 +4,5 @@ import "context"
 
 type SlackTeamsRepository interface {
 	FindTeamByID(ctx context.Context, teamID string) (*SlackTeam, error)
+	SearchTeams(ctx context.Context, query TeamSearchQuery) (*TeamSearchResult, error)
 }
@@ -0,0 +1,41 @@
+package rpc
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// TeamSearchQuery filters slack teams. Text fields match case-insensitively by prefix.
+type TeamSearchQuery struct {
+	// Query matches any of name, domain or email domain.
+	Query       string   `json:"query"`
+	Name        string   `json:"name"`
+	Domain      string   `json:"domain"`
+	EmailDomain string   `json:"emailDomain"`
+	IsDeleted   *bool    `json:"isDeleted"`
+	Tags        []string `json:"tags"`
+	Limit       int      `json:"limit"`
+	Offset      int      `json:"offset"`
+}
+
+type TeamSearchResult struct {
+	Teams  []*SlackTeam `json:"teams"`
+	Total  int64        `json:"total"`
+	Limit  int          `json:"limit"`
+	Offset int          `json:"offset"`
+}
+
+// Normalize clamps pagination to the allowed range.
+func (q TeamSearchQuery) Normalize() TeamSearchQuery {
+	if q.Limit <= 0 {
+		q.Limit = DefaultSearchLimit
+	}
+	if q.Limit > MaxSearchLimit {
+		q.Limit = MaxSearchLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	return q
+}
@@ -0,0 +1,159 @@
+// Package slack installs the app into Slack workspaces with OAuth v2.
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/shared"
+)
+
+// DefaultAPIURL is the base URL of the Slack Web API.
+const DefaultAPIURL = "https://slack.com/api"
+
+// maxResponseBytes bounds responses of the Web API, they are small JSON documents.
+const maxResponseBytes = 1 << 20
+
+// APIError is an error answered by the Web API, like invalid_code.
+type APIError struct {
+	Method string
+	Code   string
+}
+
+func (e *APIError) Error() string {
+	return "slack " + e.Method + ": " + e.Code
+}
+
+// Client calls methods of the Slack Web API.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient calls the Web API at baseURL, tests point it at a stand-in server.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: baseURL,
+		http:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// OAuthV2Access is the answer of oauth.v2.access.
+type OAuthV2Access struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+	BotUserID   string `json:"bot_user_id"`
+	AppID       string `json:"app_id"`
+	Team        *struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"team"`
+	Enterprise *struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"enterprise"`
+	IsEnterpriseInstall bool `json:"is_enterprise_install"`
+	AuthedUser          struct {
+		ID          string `json:"id"`
+		Scope       string `json:"scope"`
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	} `json:"authed_user"`
+}
+
+// OAuthV2Access exchanges the code of an install for tokens.
+func (c *Client) OAuthV2Access(ctx context.Context, clientID string, clientSecret string, code string, redirectURI string) (*OAuthV2Access, error) {
+	form := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"code":          {code},
+	}
+	if redirectURI != "" {
+		form.Set("redirect_uri", redirectURI)
+	}
+
+	var res OAuthV2Access
+	if err := c.call(ctx, "oauth.v2.access", "", form, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// TeamInfo is the answer of team.info.
+type TeamInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Domain      string `json:"domain"`
+	EmailDomain string `json:"email_domain"`
+	Icon        struct {
+		Image34      string `json:"image_34"`
+		Image44      string `json:"image_44"`
+		Image68      string `json:"image_68"`
+		Image88      string `json:"image_88"`
+		Image102     string `json:"image_102"`
+		Image132     string `json:"image_132"`
+		Image230     string `json:"image_230"`
+		ImageDefault bool   `json:"image_default"`
+	} `json:"icon"`
+}
+
+// TeamInfo gets the team of token, it needs the team:read scope.
+func (c *Client) TeamInfo(ctx context.Context, token string) (*TeamInfo, error) {
+	var res struct {
+		Team TeamInfo `json:"team"`
+	}
+	if err := c.call(ctx, "team.info", token, url.Values{}, &res); err != nil {
+		return nil, err
+	}
+
+	return &res.Team, nil
+}
+
+// call posts form to method and decodes the answer into res. Answers with ok false are APIErrors.
+func (c *Client) call(ctx context.Context, method string, token string, form url.Values, res interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, shared.FormatURL(c.baseURL, method), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.WithKind(err, errors.KindUnavailable, "Slack is unavailable")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.WithKind(errors.Errorf("slack %s: HTTP %d", method, resp.StatusCode), errors.KindUnavailable, "Slack is unavailable")
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return errors.WithKind(err, errors.KindUnavailable, "Slack is unavailable")
+	}
+
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return errors.WithKind(err, errors.KindUnavailable, "Slack answered with bad JSON")
+	}
+	if !status.OK {
+		return &APIError{Method: method, Code: status.Error}
+	}
+
+	return json.Unmarshal(body, res)
+}
@@ -0,0 +1,205 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/amqp"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	log "github.com/sirupsen/logrus"
+)
+
+// Routing keys of RevokeEvents.
+const (
+	UninstalledRoutingKey   = "slack.uninstalled"
+	TokensRevokedRoutingKey = "slack.tokensRevoked"
+)
+
+// MaxRequestAge is how old a signed request may be, older ones may be replays.
+const MaxRequestAge = 5 * time.Minute
+
+// maxEventBytes bounds bodies of the Events API, events we handle are small.
+const maxEventBytes = 1 << 20
+
+var (
+	errOnlyPOST      = errors.E(errors.KindMethodNotAllowed, "only POST requests are supported")
+	errBadSignature  = errors.E(errors.KindUnauthorized, "bad Slack signature")
+	errStaleRequest  = errors.E(errors.KindUnauthorized, "Slack request timestamp is too old")
+	errBadEventsJSON = errors.E(errors.KindInvalid, "bad request - JSON failed")
+)
+
+// RevokeEvent is published after authorizations were disabled because Slack took their tokens back.
+type RevokeEvent struct {
+	Type   string `json:"type"`
+	TeamID string `json:"teamId"`
+	// UserIDs and BotUserIDs are the users and bots whose tokens were revoked, empty on uninstalls.
+	UserIDs    []string `json:"userIds,omitempty"`
+	BotUserIDs []string `json:"botUserIds,omitempty"`
+	// Disabled is how many authorizations were disabled.
+	Disabled  int64     `json:"disabled"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+type ReceiverConfig struct {
+	// SigningSecret of the Slack app, requests are signed with it.
+	SigningSecret string
+	Repo          Repository
+	Events        Publisher
+	// EventsExchange is where RevokeEvents are published.
+	EventsExchange string
+}
+
+// Receiver serves the Events API. It disables authorizations of teams that uninstall the app
+// or revoke tokens, which emits their changes like any other update.
+type Receiver struct {
+	conf ReceiverConfig
+	now  func() time.Time
+}
+
+func NewReceiver(conf ReceiverConfig) *Receiver {
+	return &Receiver{conf: conf, now: time.Now}
+}
+
+type eventEnvelope struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	TeamID    string `json:"team_id"`
+	EventID   string `json:"event_id"`
+	Event     struct {
+		Type   string `json:"type"`
+		Tokens struct {
+			OAuth []string `json:"oauth"`
+			Bot   []string `json:"bot"`
+		} `json:"tokens"`
+	} `json:"event"`
+}
+
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.Error(w, r, errOnlyPOST)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxEventBytes))
+	if err != nil {
+		response.Error(w, r, errors.WithKind(err, errors.KindInvalid, "bad request - body failed"))
+		return
+	}
+
+	if err := rc.verify(r.Header, body); err != nil {
+		log.WithContext(r.Context()).WithError(err).Warn("Rejected a Slack event")
+		response.Error(w, r, err)
+		return
+	}
+
+	var env eventEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		response.Error(w, r, errBadEventsJSON)
+		return
+	}
+
+	if env.Type == "url_verification" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(env.Challenge))
+		return
+	}
+
+	if env.Type == "event_callback" {
+		if err := rc.handle(r.Context(), &env); err != nil {
+			// Slack retries events that fail.
+			response.Error(w, r, errors.WithKind(err, errors.KindInternal, "DB request failed"))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// verify checks the v0 signature of body and that it was signed within MaxRequestAge.
+func (rc *Receiver) verify(h http.Header, body []byte) error {
+	ts := h.Get("X-Slack-Request-Timestamp")
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errBadSignature
+	}
+
+	if age := rc.now().Sub(time.Unix(sec, 0)); age > MaxRequestAge || age < -MaxRequestAge {
+		return errStaleRequest
+	}
+
+	mac := hmac.New(sha256.New, []byte(rc.conf.SigningSecret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+
+	if !hmac.Equal([]byte(h.Get("X-Slack-Signature")), []byte("v0="+hex.EncodeToString(mac.Sum(nil)))) {
+		return errBadSignature
+	}
+
+	return nil
+}
+
+// handle disables authorizations of uninstalls and revoked tokens, other events are ignored.
+func (rc *Receiver) handle(ctx context.Context, env *eventEnvelope) error {
+	logger := log.WithContext(ctx).WithFields(log.Fields{
+		"teamId":  env.TeamID,
+		"eventId": env.EventID,
+		"event":   env.Event.Type,
+	})
+
+	if env.TeamID == "" {
+		logger.Warn("Ignored a Slack event without a team")
+		return nil
+	}
+
+	e := RevokeEvent{TeamID: env.TeamID, RevokedAt: rc.now().UTC()}
+
+	var (
+		routingKey string
+		err        error
+	)
+
+	switch env.Event.Type {
+	case "app_uninstalled":
+		e.Type, routingKey = "uninstalled", UninstalledRoutingKey
+		e.Disabled, err = rc.conf.Repo.DisableTeam(ctx, env.TeamID)
+	case "tokens_revoked":
+		e.Type, routingKey = "tokens_revoked", TokensRevokedRoutingKey
+		e.UserIDs, e.BotUserIDs = env.Event.Tokens.OAuth, env.Event.Tokens.Bot
+		e.Disabled, err = rc.conf.Repo.DisableTokens(ctx, env.TeamID, e.UserIDs, e.BotUserIDs)
+	default:
+		logger.Debug("Ignored a Slack event")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.WithField("disabled", e.Disabled).Info("Disabled authorizations of a Slack event")
+
+	if rc.conf.Events == nil {
+		return nil
+	}
+
+	// The authorizations are disabled already, so failures are only logged.
+	err = rc.conf.Events.Publish(ctx, amqp.ResponseParams{
+		Exchange:   rc.conf.EventsExchange,
+		RoutingKey: routingKey,
+		Payload:    e,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to publish revoke event")
+	}
+
+	return nil
+}
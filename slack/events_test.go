@@ -0,0 +1,184 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sign signs body like Slack does at ts with the secret.
+func sign(secret string, ts int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + strconv.FormatInt(ts, 10) + ":" + body))
+
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestReceiverVerify(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	body := `{"type":"event_callback"}`
+
+	rc := NewReceiver(ReceiverConfig{SigningSecret: "secret"})
+	rc.now = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      string
+		err       error
+	}{
+		{"valid", strconv.FormatInt(now.Unix(), 10), sign("secret", now.Unix(), body), body, nil},
+		{"slightly old", strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10), sign("secret", now.Add(-4*time.Minute).Unix(), body), body, nil},
+		{"stale", strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), sign("secret", now.Add(-6*time.Minute).Unix(), body), body, errStaleRequest},
+		{"from the future", strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), sign("secret", now.Add(6*time.Minute).Unix(), body), body, errStaleRequest},
+		{"other secret", strconv.FormatInt(now.Unix(), 10), sign("other", now.Unix(), body), body, errBadSignature},
+		{"other body", strconv.FormatInt(now.Unix(), 10), sign("secret", now.Unix(), body), `{"type":"url_verification"}`, errBadSignature},
+		{"other timestamp", strconv.FormatInt(now.Unix(), 10), sign("secret", now.Unix()-1, body), body, errBadSignature},
+		{"no signature", strconv.FormatInt(now.Unix(), 10), "", body, errBadSignature},
+		{"no timestamp", "", sign("secret", now.Unix(), body), body, errBadSignature},
+		{"bad timestamp", "soon", sign("secret", now.Unix(), body), body, errBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set("X-Slack-Request-Timestamp", tt.timestamp)
+			h.Set("X-Slack-Signature", tt.signature)
+
+			if err := rc.verify(h, []byte(tt.body)); err != tt.err {
+				t.Errorf("verify() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		signed bool
+
+		status     int
+		response   string
+		disabled   string
+		routingKey string
+	}{
+		{
+			name:     "url verification",
+			body:     `{"type":"url_verification","challenge":"abc"}`,
+			signed:   true,
+			status:   http.StatusOK,
+			response: "abc",
+		},
+		{
+			name:       "uninstall",
+			body:       `{"type":"event_callback","team_id":"T1","event":{"type":"app_uninstalled"}}`,
+			signed:     true,
+			status:     http.StatusOK,
+			disabled:   "T1",
+			routingKey: UninstalledRoutingKey,
+		},
+		{
+			name:       "tokens revoked",
+			body:       `{"type":"event_callback","team_id":"T1","event":{"type":"tokens_revoked","tokens":{"oauth":["U1"],"bot":["UBOT"]}}}`,
+			signed:     true,
+			status:     http.StatusOK,
+			disabled:   "T1:U1:UBOT",
+			routingKey: TokensRevokedRoutingKey,
+		},
+		{
+			name:   "other event",
+			body:   `{"type":"event_callback","team_id":"T1","event":{"type":"message"}}`,
+			signed: true,
+			status: http.StatusOK,
+		},
+		{
+			name:   "no team",
+			body:   `{"type":"event_callback","event":{"type":"app_uninstalled"}}`,
+			signed: true,
+			status: http.StatusOK,
+		},
+		{
+			name:   "unsigned",
+			body:   `{"type":"event_callback","team_id":"T1","event":{"type":"app_uninstalled"}}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "bad JSON",
+			body:   `{"type":`,
+			signed: true,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "GET",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{}
+			events := &fakePublisher{}
+
+			rc := NewReceiver(ReceiverConfig{
+				SigningSecret:  "secret",
+				Repo:           repo,
+				Events:         events,
+				EventsExchange: "events",
+			})
+			rc.now = func() time.Time { return now }
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			r := httptest.NewRequest(method, "/slack/events", strings.NewReader(tt.body))
+			r.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(now.Unix(), 10))
+			if tt.signed {
+				r.Header.Set("X-Slack-Signature", sign("secret", now.Unix(), tt.body))
+			}
+			w := httptest.NewRecorder()
+
+			rc.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.response != "" && w.Body.String() != tt.response {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.response)
+			}
+
+			if got := strings.Join(repo.disabled, " "); got != tt.disabled {
+				t.Errorf("disabled %q, want %q", got, tt.disabled)
+			}
+
+			if tt.routingKey == "" {
+				if len(events.published) != 0 {
+					t.Errorf("published %+v", events.published)
+				}
+				return
+			}
+
+			if len(events.published) != 1 {
+				t.Fatalf("published %d events, want 1", len(events.published))
+			}
+			p := events.published[0]
+			e, ok := p.Payload.(RevokeEvent)
+			if p.Exchange != "events" || p.RoutingKey != tt.routingKey || !ok || e.TeamID != "T1" || e.Disabled != 2 || !e.RevokedAt.Equal(now) {
+				t.Errorf("published %+v", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/amqp"
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+	"bitbucket.org/iwlab-standuply/slackteams-api/handler"
+	"bitbucket.org/iwlab-standuply/slackteams-api/response"
+	"bitbucket.org/iwlab-standuply/slackteams-api/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultAuthorizeURL is where Slack asks users to install the app.
+const DefaultAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+
+// InstalledRoutingKey is the routing key of InstallEvents.
+const InstalledRoutingKey = "slack.installed"
+
+// stateCookie keeps the nonce of the state of an install in progress.
+const stateCookie = "st_oauth_state"
+
+var (
+	errAccessDenied      = errors.E(errors.KindForbidden, "the install was cancelled in Slack")
+	errNoCode            = errors.E(errors.KindInvalid, "bad param - no code")
+	errEnterpriseInstall = errors.E(errors.KindInvalid, "installs into a whole Enterprise Grid are not supported, install into a workspace")
+	errNoTeam            = errors.E(errors.KindUnavailable, "Slack did not tell the installed team")
+)
+
+// Installation is what an install stores: the authorization of the installing user
+// and the team, when Slack told about it.
+type Installation struct {
+	Authorization *handler.SlackBotAuthorization
+	Team          *rpc.SlackTeam
+}
+
+// Repository stores installations. Installing again updates the authorization of the
+// same team and user and enables it.
+type Repository interface {
+	SaveInstallation(ctx context.Context, inst Installation) (authID string, created bool, err error)
+	// DisableTeam disables all authorizations of a team and returns how many were enabled.
+	DisableTeam(ctx context.Context, teamID string) (int64, error)
+	// DisableTokens disables authorizations of a team whose user or bot is one of the given ones.
+	DisableTokens(ctx context.Context, teamID string, userIDs []string, botUserIDs []string) (int64, error)
+}
+
+// Publisher publishes events, amqp.Client is one.
+type Publisher interface {
+	Publish(ctx context.Context, params amqp.ResponseParams) error
+}
+
+// InstallEvent is published after an install was stored. It carries no tokens.
+type InstallEvent struct {
+	Type            string `json:"type"`
+	TeamID          string `json:"teamId"`
+	TeamName        string `json:"teamName"`
+	AuthorizationID string `json:"authorizationId"`
+	UserID          string `json:"userId"`
+	BotUserID       string `json:"botUserId"`
+	Scope           string `json:"scope"`
+	// Created is false when the team and user had installed before.
+	Created     bool      `json:"created"`
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+type InstallerConfig struct {
+	Client       *Client
+	ClientID     string
+	ClientSecret string
+	// AuthorizeURL is DefaultAuthorizeURL unless tests point it elsewhere.
+	AuthorizeURL string
+	// Scopes are bot scopes, UserScopes scopes of the token of the installing user.
+	Scopes     []string
+	UserScopes []string
+	// RedirectURL is the public URL of the callback, Slack uses the one of the app when it is empty.
+	RedirectURL string
+	States      *States
+	Repo        Repository
+	Events      Publisher
+	// EventsExchange is where InstallEvents are published.
+	EventsExchange string
+	// SuccessURL is where users go after an install, with the team ID in the team param.
+	// They get a plain page when it is empty.
+	SuccessURL string
+	// BotTokenAsAccessToken stores the bot token as AccessToken when the install has no user token,
+	// the user scopes are empty then. The bot reads AccessToken, so without it such installs
+	// have an empty AccessToken.
+	BotTokenAsAccessToken bool
+}
+
+// Installer serves the OAuth v2 install flow of the app.
+type Installer struct {
+	conf InstallerConfig
+	now  func() time.Time
+}
+
+func NewInstaller(conf InstallerConfig) *Installer {
+	if conf.AuthorizeURL == "" {
+		conf.AuthorizeURL = DefaultAuthorizeURL
+	}
+
+	return &Installer{conf: conf, now: time.Now}
+}
+
+// Install sends the browser to Slack with a new state, its nonce is kept in a cookie.
+func (i *Installer) Install() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, nonce, err := i.conf.States.New(i.now())
+		if err != nil {
+			response.Error(w, r, errors.WithKind(err, errors.KindInternal, "failed to make OAuth state"))
+			return
+		}
+
+		http.SetCookie(w, i.stateCookie(r, nonce, int(i.conf.States.TTL()/time.Second)))
+
+		params := url.Values{
+			"client_id": {i.conf.ClientID},
+			"scope":     {strings.Join(i.conf.Scopes, ",")},
+			"state":     {state},
+		}
+		if len(i.conf.UserScopes) > 0 {
+			params.Set("user_scope", strings.Join(i.conf.UserScopes, ","))
+		}
+		if i.conf.RedirectURL != "" {
+			params.Set("redirect_uri", i.conf.RedirectURL)
+		}
+
+		http.Redirect(w, r, i.conf.AuthorizeURL+"?"+params.Encode(), http.StatusFound)
+	})
+}
+
+// Callback finishes an install: it checks the state, exchanges the code for tokens, stores them
+// along with the team and publishes an InstallEvent.
+func (i *Installer) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := r.URL.Query()
+
+		// The state is single use, whatever the outcome.
+		var nonce string
+		if c, err := r.Cookie(stateCookie); err == nil {
+			nonce = c.Value
+		}
+		http.SetCookie(w, i.stateCookie(r, "", -1))
+
+		if err := i.conf.States.Verify(query.Get("state"), nonce, i.now()); err != nil {
+			response.Error(w, r, err)
+			return
+		}
+
+		if e := query.Get("error"); e != "" {
+			log.WithContext(ctx).WithField("error", e).Info("Slack install cancelled")
+			response.Error(w, r, errAccessDenied)
+			return
+		}
+
+		code := query.Get("code")
+		if code == "" {
+			response.Error(w, r, errNoCode)
+			return
+		}
+
+		access, err := i.conf.Client.OAuthV2Access(ctx, i.conf.ClientID, i.conf.ClientSecret, code, i.conf.RedirectURL)
+		if err != nil {
+			response.Error(w, r, exchangeError(err))
+			return
+		}
+
+		if access.IsEnterpriseInstall {
+			response.Error(w, r, errEnterpriseInstall)
+			return
+		}
+		if access.Team == nil || access.Team.ID == "" {
+			response.Error(w, r, errNoTeam)
+			return
+		}
+
+		inst := i.installation(ctx, access)
+
+		authID, created, err := i.conf.Repo.SaveInstallation(ctx, inst)
+		if err != nil {
+			response.Error(w, r, errors.WithKind(err, errors.KindInternal, "DB request failed"))
+			return
+		}
+
+		a := inst.Authorization
+		log.WithContext(ctx).WithFields(log.Fields{
+			"teamId":          a.TeamId,
+			"userId":          a.UserId,
+			"authorizationId": authID,
+			"created":         created,
+		}).Info("Slack app installed")
+
+		i.publish(ctx, InstallEvent{
+			Type:            "installed",
+			TeamID:          a.TeamId,
+			TeamName:        a.TeamName,
+			AuthorizationID: authID,
+			UserID:          a.UserId,
+			BotUserID:       a.Bot.BotUserId,
+			Scope:           a.Scope,
+			Created:         created,
+			InstalledAt:     i.now().UTC(),
+		})
+
+		if i.conf.SuccessURL != "" {
+			http.Redirect(w, r, withParam(i.conf.SuccessURL, "team", a.TeamId), http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("The app was installed into " + a.TeamName + ", you can close this page.\n"))
+	})
+}
+
+// installation maps the answer of oauth.v2.access to what is stored. Team details are best effort,
+// the bot may lack the team:read scope.
+func (i *Installer) installation(ctx context.Context, access *OAuthV2Access) Installation {
+	accessToken := access.AuthedUser.AccessToken
+	if accessToken == "" && i.conf.BotTokenAsAccessToken {
+		accessToken = access.AccessToken
+	}
+
+	inst := Installation{
+		Authorization: &handler.SlackBotAuthorization{
+			AccessToken: accessToken,
+			Scope:       access.Scope,
+			UserId:      access.AuthedUser.ID,
+			TeamName:    access.Team.Name,
+			TeamId:      access.Team.ID,
+			Enabled:     true,
+			Bot: handler.BotInfo{
+				BotUserId:      access.BotUserID,
+				BotAccessToken: access.AccessToken,
+			},
+		},
+		Team: &rpc.SlackTeam{
+			ID:   access.Team.ID,
+			Name: access.Team.Name,
+		},
+	}
+
+	info, err := i.conf.Client.TeamInfo(ctx, access.AccessToken)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).WithField("teamId", access.Team.ID).Warn("Failed to get team info of an install")
+		return inst
+	}
+
+	inst.Team.Domain = info.Domain
+	inst.Team.EmailDomain = info.EmailDomain
+	inst.Team.Icon = rpc.SlackIcon{
+		Image34:      info.Icon.Image34,
+		Image44:      info.Icon.Image44,
+		Image68:      info.Icon.Image68,
+		Image88:      info.Icon.Image88,
+		Image102:     info.Icon.Image102,
+		Image132:     info.Icon.Image132,
+		Image230:     info.Icon.Image230,
+		ImageDefault: info.Icon.ImageDefault,
+	}
+	if info.Name != "" {
+		inst.Team.Name = info.Name
+	}
+
+	return inst
+}
+
+// publish sends e, the install is stored already so failures are only logged.
+func (i *Installer) publish(ctx context.Context, e InstallEvent) {
+	if i.conf.Events == nil {
+		return
+	}
+
+	err := i.conf.Events.Publish(ctx, amqp.ResponseParams{
+		Exchange:   i.conf.EventsExchange,
+		RoutingKey: InstalledRoutingKey,
+		Payload:    e,
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err).WithField("teamId", e.TeamID).Error("Failed to publish install event")
+	}
+}
+
+func (i *Installer) stateCookie(r *http.Request, nonce string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     stateCookie,
+		Value:    nonce,
+		Path:     "/slack/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		// Lax, as the callback is a top-level navigation from Slack.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// exchangeError tells codes Slack refused, like expired ones, from Slack being unavailable.
+func exchangeError(err error) error {
+	if apiErr, ok := err.(*APIError); ok {
+		return errors.WithKind(err, errors.KindInvalid, "Slack refused the install: "+apiErr.Code)
+	}
+
+	return err
+}
+
+func withParam(rawURL string, name string, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	q := u.Query()
+	q.Set(name, value)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,318 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/amqp"
+)
+
+type fakeRepository struct {
+	saved []Installation
+	// disabled records calls of DisableTeam and DisableTokens as team:users:bots.
+	disabled []string
+}
+
+func (r *fakeRepository) SaveInstallation(ctx context.Context, inst Installation) (string, bool, error) {
+	r.saved = append(r.saved, inst)
+	return "auth1", len(r.saved) == 1, nil
+}
+
+func (r *fakeRepository) DisableTeam(ctx context.Context, teamID string) (int64, error) {
+	r.disabled = append(r.disabled, teamID)
+	return 2, nil
+}
+
+func (r *fakeRepository) DisableTokens(ctx context.Context, teamID string, userIDs []string, botUserIDs []string) (int64, error) {
+	r.disabled = append(r.disabled, teamID+":"+strings.Join(userIDs, ",")+":"+strings.Join(botUserIDs, ","))
+	return int64(len(userIDs) + len(botUserIDs)), nil
+}
+
+type fakePublisher struct {
+	published []amqp.ResponseParams
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, params amqp.ResponseParams) error {
+	p.published = append(p.published, params)
+	return nil
+}
+
+// slackServer stands in for the Web API, it answers oauth.v2.access with access for the code "good".
+func slackServer(t *testing.T, access map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+
+		var res interface{}
+		switch r.URL.Path {
+		case "/oauth.v2.access":
+			if r.PostForm.Get("client_id") != "cid" || r.PostForm.Get("client_secret") != "secret" {
+				res = map[string]interface{}{"ok": false, "error": "invalid_client_id"}
+			} else if r.PostForm.Get("code") != "good" {
+				res = map[string]interface{}{"ok": false, "error": "invalid_code"}
+			} else {
+				res = access
+			}
+		case "/team.info":
+			res = map[string]interface{}{
+				"ok":   true,
+				"team": map[string]interface{}{"id": "T1", "name": "Acme", "domain": "acme"},
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+func TestCallback(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	userInstall := map[string]interface{}{
+		"ok":           true,
+		"access_token": "xoxb-bot",
+		"scope":        "chat:write",
+		"bot_user_id":  "UBOT",
+		"team":         map[string]interface{}{"id": "T1", "name": "Acme"},
+		"authed_user":  map[string]interface{}{"id": "U1", "access_token": "xoxp-user"},
+	}
+	botInstall := map[string]interface{}{
+		"ok":           true,
+		"access_token": "xoxb-bot",
+		"bot_user_id":  "UBOT",
+		"team":         map[string]interface{}{"id": "T1", "name": "Acme"},
+		"authed_user":  map[string]interface{}{"id": "U1"},
+	}
+	enterpriseInstall := map[string]interface{}{
+		"ok":                    true,
+		"access_token":          "xoxb-bot",
+		"is_enterprise_install": true,
+		"enterprise":            map[string]interface{}{"id": "E1"},
+	}
+
+	tests := []struct {
+		name       string
+		access     map[string]interface{}
+		query      url.Values
+		nonce      string
+		badState   bool
+		expired    bool
+		botToken   bool
+		successURL string
+
+		status      int
+		location    string
+		accessToken string
+	}{
+		{
+			name:        "user token",
+			access:      userInstall,
+			query:       url.Values{"code": {"good"}},
+			successURL:  "https://app.example.com/installed?from=slack",
+			status:      http.StatusFound,
+			location:    "https://app.example.com/installed?from=slack&team=T1",
+			accessToken: "xoxp-user",
+		},
+		{
+			name:        "bot token as access token",
+			access:      botInstall,
+			query:       url.Values{"code": {"good"}},
+			botToken:    true,
+			status:      http.StatusOK,
+			accessToken: "xoxb-bot",
+		},
+		{
+			name:        "no user token",
+			access:      botInstall,
+			query:       url.Values{"code": {"good"}},
+			status:      http.StatusOK,
+			accessToken: "",
+		},
+		{
+			name:   "refused code",
+			access: userInstall,
+			query:  url.Values{"code": {"bad"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "no code",
+			access: userInstall,
+			query:  url.Values{},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "cancelled",
+			access: userInstall,
+			query:  url.Values{"error": {"access_denied"}},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "enterprise",
+			access: enterpriseInstall,
+			query:  url.Values{"code": {"good"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "other browser",
+			access: userInstall,
+			query:  url.Values{"code": {"good"}},
+			nonce:  "other",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:     "forged state",
+			access:   userInstall,
+			query:    url.Values{"code": {"good"}},
+			badState: true,
+			status:   http.StatusBadRequest,
+		},
+		{
+			name:    "expired state",
+			access:  userInstall,
+			query:   url.Values{"code": {"good"}},
+			expired: true,
+			status:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := slackServer(t, tt.access)
+			defer api.Close()
+
+			repo := &fakeRepository{}
+			events := &fakePublisher{}
+			states := NewStates("state-secret", 10*time.Minute)
+
+			inst := NewInstaller(InstallerConfig{
+				Client:                NewClient(api.URL),
+				ClientID:              "cid",
+				ClientSecret:          "secret",
+				Scopes:                []string{"chat:write"},
+				States:                states,
+				Repo:                  repo,
+				Events:                events,
+				EventsExchange:        "events",
+				SuccessURL:            tt.successURL,
+				BotTokenAsAccessToken: tt.botToken,
+			})
+			inst.now = func() time.Time { return now }
+
+			state, nonce, err := states.New(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.badState {
+				state, _, _ = NewStates("other-secret", time.Minute).New(now)
+			}
+			if tt.expired {
+				inst.now = func() time.Time { return now.Add(11 * time.Minute) }
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			tt.query.Set("state", state)
+			r := httptest.NewRequest(http.MethodGet, "/slack/oauth/callback?"+tt.query.Encode(), nil)
+			r.AddCookie(&http.Cookie{Name: stateCookie, Value: nonce})
+			w := httptest.NewRecorder()
+
+			inst.Callback().ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if c := w.Result().Cookies(); len(c) != 1 || c[0].Name != stateCookie || c[0].MaxAge >= 0 {
+				t.Errorf("state cookie not dropped: %v", c)
+			}
+
+			if tt.status >= http.StatusBadRequest {
+				if len(repo.saved) != 0 || len(events.published) != 0 {
+					t.Errorf("failed install was saved or published")
+				}
+				return
+			}
+
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+			if tt.location == "" && w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("success page without nosniff")
+			}
+
+			if len(repo.saved) != 1 {
+				t.Fatalf("saved %d installations, want 1", len(repo.saved))
+			}
+			a := repo.saved[0].Authorization
+			if a.TeamId != "T1" || a.UserId != "U1" || !a.Enabled || a.Bot.BotAccessToken != "xoxb-bot" || a.Bot.BotUserId != "UBOT" {
+				t.Errorf("saved authorization = %+v", a)
+			}
+			if a.AccessToken != tt.accessToken {
+				t.Errorf("accessToken = %q, want %q", a.AccessToken, tt.accessToken)
+			}
+			if repo.saved[0].Team.Domain != "acme" {
+				t.Errorf("team info not saved: %+v", repo.saved[0].Team)
+			}
+
+			if len(events.published) != 1 {
+				t.Fatalf("published %d events, want 1", len(events.published))
+			}
+			p := events.published[0]
+			e, ok := p.Payload.(InstallEvent)
+			if p.Exchange != "events" || p.RoutingKey != InstalledRoutingKey || !ok || e.TeamID != "T1" || e.AuthorizationID != "auth1" || !e.Created {
+				t.Errorf("published %+v", p)
+			}
+			if body, _ := json.Marshal(p.Payload); strings.Contains(string(body), "xox") {
+				t.Errorf("install event carries a token: %s", body)
+			}
+		})
+	}
+}
+
+func TestInstall(t *testing.T) {
+	states := NewStates("state-secret", 10*time.Minute)
+	inst := NewInstaller(InstallerConfig{
+		ClientID:    "cid",
+		Scopes:      []string{"chat:write", "team:read"},
+		UserScopes:  []string{"identify"},
+		RedirectURL: "https://api.example.com/slack/oauth/callback",
+		States:      states,
+	})
+
+	w := httptest.NewRecorder()
+	inst.Install().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slack/install", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != DefaultAuthorizeURL {
+		t.Errorf("redirected to %s", got)
+	}
+
+	q := u.Query()
+	if q.Get("client_id") != "cid" || q.Get("scope") != "chat:write,team:read" || q.Get("user_scope") != "identify" || q.Get("redirect_uri") != "https://api.example.com/slack/oauth/callback" {
+		t.Errorf("authorize params = %v", q)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != stateCookie || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	if err := states.Verify(q.Get("state"), cookies[0].Value, time.Now()); err != nil {
+		t.Errorf("state does not verify with the cookie: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/iwlab-standuply/slackteams-api/errors"
+)
+
+var (
+	errBadState     = errors.E(errors.KindInvalid, "bad OAuth state")
+	errExpiredState = errors.E(errors.KindInvalid, "OAuth state expired, start the install again")
+)
+
+// States signs OAuth states as nonce.expiry.signature. The nonce is also kept in a cookie
+// of the browser that started the install, so a state cannot be used from another browser.
+type States struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewStates(secret string, ttl time.Duration) *States {
+	return &States{
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+// TTL is how long states are valid.
+func (s *States) TTL() time.Duration {
+	return s.ttl
+}
+
+// New returns a state and its nonce.
+func (s *States) New(now time.Time) (state string, nonce string, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	nonce = base64.RawURLEncoding.EncodeToString(b)
+	payload := nonce + "." + strconv.FormatInt(now.Add(s.ttl).Unix(), 10)
+
+	return payload + "." + s.sign(payload), nonce, nil
+}
+
+// Verify checks that state was signed by s, has not expired and carries nonce.
+func (s *States) Verify(state string, nonce string, now time.Time) error {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 || nonce == "" {
+		return errBadState
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(payload))) || !hmac.Equal([]byte(parts[0]), []byte(nonce)) {
+		return errBadState
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return errBadState
+	}
+	if now.Unix() > expiry {
+		return errExpiredState
+	}
+
+	return nil
+}
+
+func (s *States) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
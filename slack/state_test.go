@@ -0,0 +1,65 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatesVerify(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	states := NewStates("secret", 10*time.Minute)
+
+	state, nonce, err := states.New(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := NewStates("other", 10*time.Minute).New(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		state string
+		nonce string
+		now   time.Time
+		err   error
+	}{
+		{"valid", state, nonce, now, nil},
+		{"at expiry", state, nonce, now.Add(10 * time.Minute), nil},
+		{"expired", state, nonce, now.Add(10*time.Minute + time.Second), errExpiredState},
+		{"other nonce", state, "other", now, errBadState},
+		{"no nonce", state, "", now, errBadState},
+		{"other secret", other, nonce, now, errBadState},
+		{"tampered expiry", tamper(state, 1, "9999999999"), nonce, now, errBadState},
+		{"malformed", "abc", nonce, now, errBadState},
+		{"empty", "", nonce, now, errBadState},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := states.Verify(tt.state, tt.nonce, tt.now); err != tt.err {
+				t.Errorf("Verify() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestStatesNewIsUnique(t *testing.T) {
+	states := NewStates("secret", time.Minute)
+
+	a, _, _ := states.New(time.Now())
+	b, _, _ := states.New(time.Now())
+	if a == b {
+		t.Errorf("two states are equal: %s", a)
+	}
+}
+
+// tamper replaces the part i of a state.
+func tamper(state string, i int, value string) string {
+	parts := strings.Split(state, ".")
+	parts[i] = value
+
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,110 @@
+// Package sse fans events out to Server-Sent Events connections.
+package sse
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Event is a single server-sent event. ID lets clients resume after it with Last-Event-ID.
+type Event struct {
+	ID   string
+	Type string
+	Data []byte
+}
+
+// Write writes e in the event stream format.
+func Write(w io.Writer, e Event) error {
+	var b strings.Builder
+
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Type != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Type)
+	}
+	for _, line := range strings.Split(string(e.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Subscription receives events published after it was made.
+type Subscription struct {
+	events chan Event
+}
+
+// Events is closed when the subscription is dropped for falling behind or cancelled.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Broker delivers every published event to all subscriptions. Publishing never blocks:
+// a subscription whose buffer is full is dropped, its client is expected to reconnect
+// and resume from the last event it got.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	buffer int
+}
+
+func NewBroker(buffer int) *Broker {
+	return &Broker{
+		subs:   map[*Subscription]struct{}{},
+		buffer: buffer,
+	}
+}
+
+func (b *Broker) Subscribe() *Subscription {
+	s := &Subscription{
+		events: make(chan Event, b.buffer),
+	}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s
+}
+
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(s)
+}
+
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		select {
+		case s.events <- e:
+		default:
+			b.remove(s)
+		}
+	}
+}
+
+// Subscribers returns the number of open subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subs)
+}
+
+func (b *Broker) remove(s *Subscription) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+
+	delete(b.subs, s)
+	close(s.events)
+}